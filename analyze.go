@@ -5,6 +5,7 @@ import (
 	"image/color"
 	"log"
 	"math"
+	"slices"
 	"sort"
 )
 
@@ -64,7 +65,7 @@ func (img *sourceImage) checkBounds() error {
 		return nil
 	case img.hasSpriteDimensions():
 		return nil
-	case img.opt.CurrentGraphicsType == singleColorSprites || img.opt.CurrentGraphicsType == multiColorSprites:
+	case img.opt.CurrentGraphicsType.isSprites():
 		if img.opt.Verbose {
 			log.Printf("sprites forced, allowing non-sprite dimension %d * %d", img.width, img.height)
 		}
@@ -194,7 +195,7 @@ func (img *sourceImage) analyze() (err error) {
 		if err = img.findBackgroundColor(); err != nil {
 			return fmt.Errorf("findBackgroundColor failed: %w", err)
 		}
-	case ecmCharset:
+	case ecmCharset, ecmPETSCIICharset:
 		if err = img.findECMColors(); err != nil {
 			return fmt.Errorf("findECMColors failed: %w", err)
 		}
@@ -218,14 +219,51 @@ func (img *sourceImage) analyzeSprites() error {
 	if img.width/SpriteWidth == 0 || img.height/SpriteHeight == 0 {
 		return fmt.Errorf("%d X-sprites x %d Y-sprites: cant have 0 sprites", img.width/SpriteWidth, img.height/SpriteHeight)
 	}
+	if img.opt.CurrentGraphicsType == layeredSprites {
+		// the colors are analyzed per layer by img.LayeredSprites.
+		img.graphicsType = layeredSprites
+		if !img.opt.Quiet {
+			fmt.Printf("graphics mode forced: %s\n", img.graphicsType)
+		}
+		return img.findBackgroundColor()
+	}
 
+	sets, err := img.spriteColorSets()
+	if err != nil {
+		return fmt.Errorf("img.spriteColorSets failed: %w", err)
+	}
 	switch {
 	case img.p.NumColors() <= 2:
 		img.graphicsType = singleColorSprites
 	case img.p.NumColors() == 3 || img.p.NumColors() == 4:
 		img.graphicsType = multiColorSprites
 	default:
-		return fmt.Errorf("too many colors %d > 4", img.p.NumColors())
+		// sprites with individual colors
+		max := 0
+		for _, set := range sets {
+			if len(set) > max {
+				max = len(set)
+			}
+		}
+		switch {
+		case max <= 2:
+			img.graphicsType = singleColorSprites
+		case max <= 4:
+			img.graphicsType = multiColorSprites
+		default:
+			return fmt.Errorf("too many colors %d > 4 in a sprite", max)
+		}
+	}
+	if img.graphicsType == multiColorSprites {
+		// singlecolor sprites with hires pixels, combined with multicolor sprites
+		hires, mc := false, false
+		for i, h := range img.hiresSprites(sets) {
+			hires = hires || h
+			mc = mc || len(sets[i]) > 2
+		}
+		if hires && mc {
+			img.graphicsType = mixedSprites
+		}
 	}
 
 	if !img.opt.Quiet {
@@ -237,7 +275,7 @@ func (img *sourceImage) analyzeSprites() error {
 			if !img.opt.Quiet {
 				fmt.Printf("graphics mode forced: %s\n", img.graphicsType)
 			}
-			if img.opt.CurrentGraphicsType != singleColorSprites && img.opt.CurrentGraphicsType != multiColorSprites {
+			if !img.opt.CurrentGraphicsType.isSprites() {
 				return fmt.Errorf("cannot force mode to %s for images in sprite dimensions", img.opt.CurrentGraphicsType)
 			}
 		}
@@ -250,6 +288,10 @@ func (img *sourceImage) analyzeSprites() error {
 		return nil
 	}
 	max, _, sumColors := img.countSpriteColors()
+	if max > 4 {
+		// individual sprite colors are not part of the bitpair colors
+		max = 4
+	}
 	img.guessPreferredBitpairColors(max, sumColors)
 	return nil
 }
@@ -419,12 +461,160 @@ func (img *sourceImage) findBgCandidates(hires bool) {
 	return
 }
 
+// findRowColors solves the d022 and d023 colors for each char row, bg is shared by all rows.
+// Colors in fixed are available in all chars, like the d800 charcolor in multicolor charsets.
+// If d800 is true, each char may use one extra color 0-7 from colorram, like in mixed charsets.
+// Each row is returned as BPColors {bg, d022, d023}. Colors of the previous row are reused where possible,
+// unused d022/d023 colors are copied from neighbouring rows to minimize register writes.
+func (img *sourceImage) findRowColors(bg Color, fixed Colors, d800 bool) (rows [FullScreenRows]BPColors, err error) {
+	shared := func(col Color, pair BPColors) bool {
+		return col.C64Color == bg.C64Color || pair.Contains(col) || slices.ContainsFunc(fixed, func(c Color) bool { return c.C64Color == col.C64Color })
+	}
+	possible := func(row int, pair BPColors) bool {
+		for char := row * 40; char < row*40+40; char++ {
+			extra := 0
+			for _, col := range img.charColors[char] {
+				if shared(col, pair) {
+					continue
+				}
+				if !d800 || col.C64Color > 7 {
+					return false
+				}
+				extra++
+			}
+			if extra > 1 {
+				return false
+			}
+		}
+		return true
+	}
+
+	prev := BPColors{nil, nil}
+	if len(img.bpc) > 2 {
+		prev = BPColors{img.bpc[1], img.bpc[2]}
+	}
+	for row := range rows {
+		sum := [MaxColors]int{}
+		for char := row * 40; char < row*40+40; char++ {
+			for _, col := range img.charColors[char] {
+				if !shared(col, nil) {
+					sum[col.C64Color]++
+				}
+			}
+		}
+		cc := Colors{}
+		for col, count := range sum {
+			if count > 0 {
+				cc = append(cc, img.p.FromC64NoErr(C64Color(col)))
+			}
+		}
+		pairs := []BPColors{{nil, nil}}
+		for i := range cc {
+			pairs = append(pairs, BPColors{&cc[i], nil})
+			for j := i + 1; j < len(cc); j++ {
+				pairs = append(pairs, BPColors{&cc[i], &cc[j]})
+			}
+		}
+		score := func(pair BPColors) (n int) {
+			for _, col := range pair.Colors() {
+				if prev.Contains(col) {
+					n += 1000
+				}
+				n += sum[col.C64Color]
+			}
+			return n
+		}
+		sort.SliceStable(pairs, func(i, j int) bool { return score(pairs[i]) > score(pairs[j]) })
+
+		found := false
+		for _, pair := range pairs {
+			if !possible(row, pair) {
+				continue
+			}
+			if (pair[0] != nil && prev[1] != nil && pair[0].C64Color == prev[1].C64Color) || (pair[1] != nil && prev[0] != nil && pair[1].C64Color == prev[0].C64Color) {
+				pair[0], pair[1] = pair[1], pair[0]
+			}
+			for i := range pair {
+				if pair[i] == nil && !(prev[i] != nil && pair.Contains(*prev[i])) {
+					pair[i] = prev[i]
+				}
+			}
+			rows[row] = BPColors{&bg, pair[0], pair[1]}
+			prev = pair
+			found = true
+			break
+		}
+		if !found {
+			return rows, fmt.Errorf("no d022/d023 colors possible in char row %d (y=%d) with background color %d", row, row*8, bg.C64Color)
+		}
+	}
+
+	// backfill unused colors of the first rows
+	for i := 1; i < 3; i++ {
+		for row := FullScreenRows - 2; row >= 0; row-- {
+			if rows[row][i] == nil {
+				rows[row][i] = rows[row+1][i]
+			}
+		}
+	}
+	if img.opt.Verbose {
+		for row := range rows {
+			log.Printf("char row %d: -bitpair-colors %s", row, rows[row])
+		}
+	}
+	return rows, nil
+}
+
+// findMultiColorRowColors finds the background and charcolor shared by all char rows and solves d022/d023 per char row.
+// Preferred colors in img.bpc are tried first.
+func (img *sourceImage) findMultiColorRowColors() (charcol *Color, rows [FullScreenRows]BPColors, err error) {
+	bgs := Colors{}
+	if len(img.bpc) > 0 && img.bpc[0] != nil {
+		bgs = append(bgs, *img.bpc[0])
+	}
+	for _, col := range img.SortedColors() {
+		if !In(bgs, col) {
+			bgs = append(bgs, col)
+		}
+	}
+	charcols := BPColors{}
+	if len(img.bpc) > 3 && img.bpc[3] != nil && img.bpc[3].C64Color < 8 {
+		charcols = append(charcols, img.bpc[3])
+	}
+	for _, col := range img.SortedColors() {
+		if col.C64Color < 8 && !charcols.Contains(col) {
+			c := col
+			charcols = append(charcols, &c)
+		}
+	}
+	charcols = append(charcols, nil)
+
+	for _, bg := range bgs {
+		for _, charcol = range charcols {
+			if charcol != nil && charcol.C64Color == bg.C64Color {
+				continue
+			}
+			fixed := Colors{}
+			if charcol != nil {
+				fixed = append(fixed, *charcol)
+			}
+			if rows, err = img.findRowColors(bg, fixed, false); err == nil {
+				return charcol, rows, nil
+			}
+			if img.opt.VeryVerbose {
+				log.Printf("findRowColors with background color %d and charcolor %s failed: %v", bg.C64Color, charcol, err)
+			}
+		}
+	}
+	return nil, rows, fmt.Errorf("no background and charcolor combination found for all char rows")
+}
+
 // findBackgroundColor figures out the background color (forced or detected) and checks if the background color is possible.
 // It sets img.backgroundColor to the correct color, which may differ from what was wanted if that color is not possible.
 // returns error if no background color is found or possible.
 func (img *sourceImage) findBackgroundColor() error {
 	var sumColors = img.sumColors
-	isSprites := img.graphicsType == singleColorSprites || img.graphicsType == multiColorSprites
+	isSprites := img.graphicsType.isSprites()
 	if isSprites {
 		_, _, sumColors = img.countSpriteColors()
 	}
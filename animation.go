@@ -19,6 +19,10 @@ const (
 
 	hiresFadePassStart  = 0xac00
 	hiresAnimationStart = 0x4400
+
+	spriteAnimationSettings = 0x1ff0
+	spriteAnimationStart    = 0x2000
+	MaxAnimationSprites     = (VICBankSize - spriteAnimationStart) / 64
 )
 
 // WriteAnimationTo processes all images and writes the resulting .prg to w.
@@ -35,6 +39,15 @@ func (c *Converter) WriteAnimationTo(w io.Writer) (n int64, err error) {
 	if len(imgs) < 1 {
 		return n, fmt.Errorf("no sourceImage given")
 	}
+	if c.opt.RowColors {
+		return n, fmt.Errorf("-row-colors is not supported for animations")
+	}
+	if c.opt.CharsetSplits != "" {
+		return n, fmt.Errorf("-charset-splits is not supported for animations")
+	}
+	if c.opt.CharsetFile != "" {
+		return n, fmt.Errorf("-charset is not supported for animations")
+	}
 	c.opt.disableRepeatingBitpairColors = true
 	for i := range imgs {
 		imgs[i].opt.disableRepeatingBitpairColors = true
@@ -93,6 +106,9 @@ func (c *Converter) WriteAnimationTo(w io.Writer) (n int64, err error) {
 			return n, fmt.Errorf("bitpairColors differ between frames, maybe use -bitpair-colors %s to force them", currentBitpairColors)
 		}
 
+		if img.graphicsType.isSprites() && (c.opt.SpriteDedup || c.opt.SpriteMirror || c.opt.SpriteTrim) {
+			return n, fmt.Errorf("-sprite-dedup, -sprite-mirror and -sprite-trim are not supported for animations")
+		}
 		switch img.graphicsType {
 		case multiColorBitmap:
 			k, err := img.Koala()
@@ -106,7 +122,7 @@ func (c *Converter) WriteAnimationTo(w io.Writer) (n int64, err error) {
 				return n, fmt.Errorf("img.Hires failed: %w", err)
 			}
 			hh = append(hh, h)
-		case multiColorSprites:
+		case multiColorSprites, mixedSprites:
 			s, err := img.MultiColorSprites()
 			if err != nil {
 				return n, fmt.Errorf("img.MultiColorSprites failed: %w", err)
@@ -174,6 +190,9 @@ func (c *Converter) WriteAnimationTo(w io.Writer) (n int64, err error) {
 		}
 	}
 
+	if c.opt.PETSCIIExport != "" {
+		return c.exportPETSCII(w, petCharsets)
+	}
 	if c.opt.Display {
 		m, err := c.writeAnimationDisplayerTo(w, imgs, kk, hh, scSprites, mcSprites, mcCharsets, scCharsets, petCharsets, mixCharsets)
 		n += m
@@ -247,27 +266,55 @@ func (c *Converter) WriteAnimationTo(w io.Writer) (n int64, err error) {
 		}
 		return n, nil
 	case len(mcSprites) > 0:
-		data := [][]byte{defaultHeader()}
+		data := [][]byte{spriteHeader(c.opt)}
+		bitmap := []byte{}
 		for _, s := range mcSprites {
 			data = append(data, s.Bitmap)
+			bitmap = append(bitmap, s.Bitmap...)
 			if !c.opt.Quiet {
 				fmt.Printf("converted %q to %q\n", s.SourceFilename, c.opt.OutFile)
 			}
 		}
-		c.Symbols = append(c.Symbols, mcSprites[0].Symbols()...)
+		delays, err := c.spriteFrameDelays(len(mcSprites))
+		if err != nil {
+			return n, fmt.Errorf("spriteFrameDelays failed: %w", err)
+		}
+		data = append(data, delays)
+		if err = checkSpriteMemory(c.opt, len(bitmap), len(bitmap)/64); err != nil {
+			return n, fmt.Errorf("checkSpriteMemory failed: %w", err)
+		}
+		// the color and object tables are not written for animations, the sprite pointers include all frames.
+		s0 := mcSprites[0]
+		s0.Bitmap, s0.Colors, s0.Index = bitmap, nil, nil
+		c.Symbols = append(c.Symbols, s0.Symbols()...)
+		c.Symbols = append(c.Symbols, spriteAnimationSymbols(c.opt, len(bitmap), len(delays))...)
 		if _, err = writeData(w, data...); err != nil {
 			return n, fmt.Errorf("writeData %q failed: %w", c.opt.OutFile, err)
 		}
 		return n, nil
 	case len(scSprites) > 0:
-		data := [][]byte{defaultHeader()}
+		data := [][]byte{spriteHeader(c.opt)}
+		bitmap := []byte{}
 		for _, s := range scSprites {
 			data = append(data, s.Bitmap)
+			bitmap = append(bitmap, s.Bitmap...)
 			if !c.opt.Quiet {
 				fmt.Printf("converted %q to %q\n", s.SourceFilename, c.opt.OutFile)
 			}
 		}
-		c.Symbols = append(c.Symbols, scSprites[0].Symbols()...)
+		delays, err := c.spriteFrameDelays(len(scSprites))
+		if err != nil {
+			return n, fmt.Errorf("spriteFrameDelays failed: %w", err)
+		}
+		data = append(data, delays)
+		if err = checkSpriteMemory(c.opt, len(bitmap), len(bitmap)/64); err != nil {
+			return n, fmt.Errorf("checkSpriteMemory failed: %w", err)
+		}
+		// the color and object tables are not written for animations, the sprite pointers include all frames.
+		s0 := scSprites[0]
+		s0.Bitmap, s0.Colors, s0.Index = bitmap, nil, nil
+		c.Symbols = append(c.Symbols, s0.Symbols()...)
+		c.Symbols = append(c.Symbols, spriteAnimationSymbols(c.opt, len(bitmap), len(delays))...)
 		if _, err = writeData(w, data...); err != nil {
 			return n, fmt.Errorf("writeData %q failed: %w", c.opt.OutFile, err)
 		}
@@ -367,8 +414,8 @@ func (c *Converter) WriteAnimationTo(w io.Writer) (n int64, err error) {
 			c64Symbol{"animation", 0x3000},
 			c64Symbol{"d020color", int(petCharsets[0].BorderColor)},
 			c64Symbol{"d021color", int(petCharsets[0].BackgroundColor)},
-			c64Symbol{"lowercase", int(petCharsets[0].Lowercase)},
 		)
+		c.Symbols = append(c.Symbols, c.opt.romCharsetSymbols(petCharsets[0].ROMCharset, petCharsets[0].Lowercase)...)
 		if _, err = c.WritePETSCIICharsetAnimationTo(w, petCharsets); err != nil {
 			return n, fmt.Errorf("WritePETSCIICharsetAnimationTo failed: %w", err)
 		}
@@ -535,6 +582,48 @@ func (c *Converter) writeAnimationDisplayerTo(w io.Writer, imgs []sourceImage, k
 		if _, err = c.WritePETSCIICharsetAnimationTo(buf, petCharsets); err != nil {
 			return n, fmt.Errorf("WritePETSCIICharsetAnimationTo buf failed: %w", err)
 		}
+	case len(mcSprites) > 0:
+		frames := [][]byte{}
+		for _, s := range mcSprites {
+			frames = append(frames, s.Bitmap)
+		}
+		s0 := mcSprites[0]
+		s0.Bitmap = bytes.Join(frames, nil)
+		c.Symbols = append(c.Symbols, s0.Symbols()...)
+		c.Symbols = append(c.Symbols, spriteAnimationSymbols(c.opt, len(s0.Bitmap), len(frames))...)
+		header := []byte{s0.Columns, s0.Rows, s0.BackgroundColor, s0.D025Color, s0.D026Color}
+		if c.opt.NoCrunch {
+			m, err := c.WriteSpritesDisplayAnimTo(w, header, frames)
+			n += m
+			if err != nil {
+				return n, fmt.Errorf("WriteSpritesDisplayAnimTo failed: %w", err)
+			}
+			return n, nil
+		}
+		if _, err = c.WriteSpritesDisplayAnimTo(buf, header, frames); err != nil {
+			return n, fmt.Errorf("WriteSpritesDisplayAnimTo buf failed: %w", err)
+		}
+	case len(scSprites) > 0:
+		frames := [][]byte{}
+		for _, s := range scSprites {
+			frames = append(frames, s.Bitmap)
+		}
+		s0 := scSprites[0]
+		s0.Bitmap = bytes.Join(frames, nil)
+		c.Symbols = append(c.Symbols, s0.Symbols()...)
+		c.Symbols = append(c.Symbols, spriteAnimationSymbols(c.opt, len(s0.Bitmap), len(frames))...)
+		header := []byte{s0.Columns, s0.Rows, s0.BackgroundColor, 0, 0}
+		if c.opt.NoCrunch {
+			m, err := c.WriteSpritesDisplayAnimTo(w, header, frames)
+			n += m
+			if err != nil {
+				return n, fmt.Errorf("WriteSpritesDisplayAnimTo failed: %w", err)
+			}
+			return n, nil
+		}
+		if _, err = c.WriteSpritesDisplayAnimTo(buf, header, frames); err != nil {
+			return n, fmt.Errorf("WriteSpritesDisplayAnimTo buf failed: %w", err)
+		}
 	default:
 		return n, fmt.Errorf("animation displayers do not support %q", imgs[0].graphicsType)
 	}
@@ -679,6 +768,77 @@ func (c *Converter) WriteFrameDelayByte(w io.Writer, frameIndex, totalFrames int
 	return n, nil
 }
 
+// spriteFrameDelays returns the frame delay table of a sprite animation, 1 byte per frame.
+// Optionally uses c.AnimItems for timing.
+func (c *Converter) spriteFrameDelays(numFrames int) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	for i := 0; i < numFrames; i++ {
+		if _, err := c.WriteFrameDelayByte(buf, i, numFrames); err != nil {
+			return nil, fmt.Errorf("WriteFrameDelayByte failed: %w", err)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// spriteAnimationSymbols returns the symbols of the frame delay table, stored after size bytes of sprites.
+// The sprites of frame n start at bitmap + n * columns * rows * 64.
+func spriteAnimationSymbols(opt Options, size, numFrames int) []c64Symbol {
+	return []c64Symbol{
+		{"numframes", numFrames},
+		{"framedelays", opt.spriteAddress() + size},
+	}
+}
+
+// WriteSpritesDisplayAnimTo writes the sprite animation displayer, the sprites of all frames and the frame delay table to w.
+// The header contains the columns, rows, background, d025 and d026 colors of the sprites.
+// Each frame has columns * rows sprites, the displayer cycles the sprite pointers of the first 8 sprites of each frame.
+// Optionally uses c.AnimItems for timing.
+func (c *Converter) WriteSpritesDisplayAnimTo(w io.Writer, header []byte, frames [][]byte) (n int64, err error) {
+	opt := c.opt
+	for i := range frames {
+		if len(frames[i]) != len(frames[0]) {
+			return n, fmt.Errorf("frame %d has %d sprites instead of %d, all frames need the same size", i, len(frames[i])/64, len(frames[0])/64)
+		}
+	}
+	bitmap := bytes.Join(frames, nil)
+	numSprites := len(bitmap) / 64
+	if numSprites > MaxAnimationSprites {
+		return n, fmt.Errorf("the sprite animation displayer supports max %d sprites, not %d", MaxAnimationSprites, numSprites)
+	}
+	delays, err := c.spriteFrameDelays(len(frames))
+	if err != nil {
+		return n, fmt.Errorf("spriteFrameDelays failed: %w", err)
+	}
+
+	link := NewLinker(0, opt.VeryVerbose)
+	if _, err = link.WritePrg(spritesDisplayAnim); err != nil {
+		return n, fmt.Errorf("link.WritePrg error: %w", err)
+	}
+	link.SetByte(DisplayerSettingsStart+7, byte(opt.FrameDelay), byte(opt.WaitSeconds), opt.NoFadeByte(), opt.NoLoopByte())
+	if !opt.Quiet {
+		fmt.Printf("memory usage for displayer code: %s - %s\n", link.StartAddress(), link.EndAddress())
+	}
+	delaysAddress := spriteAnimationStart + len(bitmap)
+	settings := append(header, byte(len(frames[0])/64), byte(len(frames)), byte(delaysAddress), byte(delaysAddress>>8))
+	if _, err = link.WriteMap(LinkMap{
+		spriteAnimationSettings: settings,
+		spriteAnimationStart:    bitmap,
+		Word(delaysAddress):     delays,
+	}); err != nil {
+		return n, fmt.Errorf("link.WriteMap error: %w", err)
+	}
+	if !opt.Quiet {
+		fmt.Printf("memory usage for sprite animation: %s - %s\n", Word(spriteAnimationSettings), link.EndAddress())
+	}
+
+	if err = injectSID(link, opt.IncludeSID, opt.Quiet); err != nil {
+		return n, fmt.Errorf("injectSID failed: %w", err)
+	}
+	m, err := link.WriteTo(w)
+	n += int64(m)
+	return n, err
+}
+
 // WriteKoalaDisplayAnimTo processes kk and writes the converted animation and displayer to w.
 // Optionally uses c.AnimItems for timing.
 func (c *Converter) WriteKoalaDisplayAnimTo(w io.Writer, kk []Koala) (n int64, err error) {
@@ -1146,6 +1306,11 @@ func (c *Converter) WritePETSCIICharsetAnimationTo(w io.Writer, cc []PETSCIIChar
 	if len(cc) < 2 {
 		return n, fmt.Errorf("not enough images %d < 2", len(cc))
 	}
+	for i := range cc {
+		if cc[i].ROMCharset != cc[0].ROMCharset {
+			return n, fmt.Errorf("frame %d uses the %s rom charset, frame 0 uses %s, all frames must use the same rom charset", i, cc[i].ROMCharset, cc[0].ROMCharset)
+		}
+	}
 	link := NewLinker(0x2000, cc[0].opt.VeryVerbose)
 	_, err = link.WriteMap(LinkMap{
 		0x2800: cc[0].Screen[:],
@@ -1229,6 +1394,9 @@ func (c *Converter) WritePETSCIICharsetAnimationTo(w io.Writer, cc []PETSCIIChar
 	}
 
 	if cc[0].opt.Display {
+		if !isBuiltinROMCharset(cc[0].ROMCharset) {
+			return n, fmt.Errorf("the petscii displayer does not support the %q rom charset, only uppercase and lowercase", cc[0].ROMCharset)
+		}
 		if _, err = link.WritePrg(petsciiCharsetDisplayAnim); err != nil {
 			return n, fmt.Errorf("link.WritePrg failed: %w", err)
 		}
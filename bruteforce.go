@@ -293,6 +293,13 @@ NEXTJOB:
 				}
 				continue NEXTJOB
 			}
+		case ecmPETSCIICharset:
+			if wt, err = img.ECMPETSCIICharset(); err != nil {
+				if img.opt.VeryVerbose {
+					log.Printf("img.ECMPETSCIICharset %q failed: %v", img.sourceFilename, err)
+				}
+				continue NEXTJOB
+			}
 		case mixedCharset:
 			if len(img.bpc) > 3 {
 				if img.bpc[3].C64Color > 7 {
@@ -0,0 +1,80 @@
+package png2prg
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+)
+
+// validateCharOrder checks the -char-order option and its combinations.
+func validateCharOrder(opt Options) error {
+	switch opt.CharOrder {
+	case "", "appearance":
+		return nil
+	case "frequency", "similarity":
+		if opt.CharsetFile != "" {
+			return fmt.Errorf("-char-order %s can not be combined with -charset, the chars of the charset file keep their index", opt.CharOrder)
+		}
+		if opt.CharsetSplits != "" {
+			return fmt.Errorf("-char-order %s can not be combined with -charset-splits", opt.CharOrder)
+		}
+		return nil
+	case "stable":
+		if opt.CharsetFile == "" {
+			return fmt.Errorf("-char-order stable requires -charset with the charset of the previous conversion")
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown -char-order %q, use appearance, frequency, similarity or stable", opt.CharOrder)
+}
+
+// orderChars reorders the chars of charset according to img.opt.CharOrder and updates the screen accordingly.
+// The first fixed chars (eg a prebuilt charset) keep their index.
+// Only the bits in mask of the screen refer to the char index, for ecm this is 0x3f.
+func (img *sourceImage) orderChars(screen *[FullScreenChars]byte, charset []charBytes, fixed int, mask byte) []charBytes {
+	if fixed >= len(charset) {
+		return charset
+	}
+	order := make([]int, len(charset)-fixed)
+	for i := range order {
+		order[i] = fixed + i
+	}
+	switch img.opt.CharOrder {
+	case "frequency":
+		count := make([]int, len(charset))
+		for _, v := range screen {
+			count[int(v&mask)]++
+		}
+		sort.SliceStable(order, func(i, j int) bool {
+			return count[order[i]] > count[order[j]]
+		})
+	case "similarity":
+		// greedy nearest neighbour, so consecutive chars differ in as few bits as possible.
+		for i := 1; i < len(order); i++ {
+			prev := charset[order[i-1]]
+			best := i
+			for j := i + 1; j < len(order); j++ {
+				if hiresCharDistance(prev, charset[order[j]]) < hiresCharDistance(prev, charset[order[best]]) {
+					best = j
+				}
+			}
+			order[i], order[best] = order[best], order[i]
+		}
+	default:
+		return charset
+	}
+
+	newIndex := make([]int, len(charset))
+	for i := 0; i < fixed; i++ {
+		newIndex[i] = i
+	}
+	ordered := slices.Clone(charset[:fixed])
+	for _, old := range order {
+		newIndex[old] = len(ordered)
+		ordered = append(ordered, charset[old])
+	}
+	for char, v := range screen {
+		screen[char] = v&^mask | byte(newIndex[int(v&mask)])
+	}
+	return ordered
+}
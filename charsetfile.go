@@ -0,0 +1,192 @@
+package png2prg
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// LoadCharsetFile reads the charset in filename and returns its chars.
+// Supported formats are a raw .bin, a .prg with load address or an image of 8x8 chars.
+// Only the first 256 chars are used.
+// For images, the most used color is considered background (bit 0), all other colors are bit 1.
+func LoadCharsetFile(filename string) ([]charBytes, error) {
+	bin, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("os.ReadFile %q failed: %w", filename, err)
+	}
+	switch {
+	case isCharsetImage(filename):
+		im, _, err := image.Decode(bytes.NewReader(bin))
+		if err != nil {
+			return nil, fmt.Errorf("image.Decode %q failed: %w", filename, err)
+		}
+		return imageToCharBytes(im)
+	case strings.ToLower(filepath.Ext(filename)) == ".prg":
+		if len(bin) < 2 {
+			return nil, fmt.Errorf("charset %q is too short to contain a load address", filename)
+		}
+		bin = bin[2:]
+	}
+	if len(bin) > MaxChars*8 {
+		// eg a rom dump with both upper and lowercase charsets, only use the first charset.
+		bin = bin[:MaxChars*8]
+	}
+	if len(bin)%8 != 0 {
+		return nil, fmt.Errorf("charset %q does not consist of 8 byte chars, %d %% 8 == %d", filename, len(bin), len(bin)%8)
+	}
+	cb := []charBytes{}
+	for i := 0; i < len(bin); i += 8 {
+		c := charBytes{}
+		copy(c[:], bin[i:i+8])
+		cb = append(cb, c)
+	}
+	return cb, nil
+}
+
+// isCharsetImage returns true if the -charset filename is an image of 8x8 chars.
+// Image charsets are read at 1 bit per pixel, so they only support singlecolor and ecm charsets.
+func isCharsetImage(filename string) bool {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".png", ".gif", ".jpg", ".jpeg":
+		return true
+	}
+	return false
+}
+
+// imageToCharBytes converts the 8x8 chars in im to charBytes, from left to right and top to bottom.
+func imageToCharBytes(im image.Image) ([]charBytes, error) {
+	b := im.Bounds()
+	if b.Dx()%8 != 0 || b.Dy()%8 != 0 {
+		return nil, fmt.Errorf("charset image resolution %dx%d is not a multiple of 8x8", b.Dx(), b.Dy())
+	}
+	if (b.Dx()/8)*(b.Dy()/8) > MaxChars {
+		return nil, fmt.Errorf("charset image contains %d chars, the max is %d", (b.Dx()/8)*(b.Dy()/8), MaxChars)
+	}
+	count := map[colorKey]int{}
+	var bg colorKey
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			k := ColorKey(im.At(x, y))
+			count[k]++
+			if count[k] > count[bg] {
+				bg = k
+			}
+		}
+	}
+	cb := []charBytes{}
+	for cy := b.Min.Y; cy < b.Max.Y; cy += 8 {
+		for cx := b.Min.X; cx < b.Max.X; cx += 8 {
+			c := charBytes{}
+			for y := 0; y < 8; y++ {
+				for x := 0; x < 8; x++ {
+					if ColorKey(im.At(cx+x, cy+y)) != bg {
+						c[y] |= 1 << (7 - x)
+					}
+				}
+			}
+			cb = append(cb, c)
+		}
+	}
+	return cb, nil
+}
+
+// parseCharRanges parses comma separated char indexes and ranges, eg "0-63,128".
+func parseCharRanges(in string) (slots [MaxChars]bool, err error) {
+	for _, v := range strings.Split(in, ",") {
+		first, last, isRange := strings.Cut(strings.TrimSpace(v), "-")
+		start, err := strconv.Atoi(first)
+		if err != nil {
+			return slots, fmt.Errorf("strconv.Atoi conversion of %q to integer failed: %w", v, err)
+		}
+		end := start
+		if isRange {
+			if end, err = strconv.Atoi(last); err != nil {
+				return slots, fmt.Errorf("strconv.Atoi conversion of %q to integer failed: %w", v, err)
+			}
+		}
+		if start < 0 || end >= MaxChars || start > end {
+			return slots, fmt.Errorf("incorrect char range %q, use values 0-%d", v, MaxChars-1)
+		}
+		for i := start; i <= end; i++ {
+			slots[i] = true
+		}
+	}
+	return slots, nil
+}
+
+// fitCharsetFile maps cbufs onto the charset loaded with -charset.
+// Chars already present in the charset are reused, new chars are stored in free slots.
+// The slots in -charset-reserve are never overwritten, without -charset-reserve all chars of the charset are kept.
+// With -char-order stable, chars that are no longer used are not kept, so their slots are free for new chars.
+// It returns the screen and the resulting charset, or an error reporting how many new chars do not fit.
+func (img *sourceImage) fitCharsetFile(cbufs [FullScreenChars]charBytes, maxChars int) (screen [FullScreenChars]byte, charset []charBytes, err error) {
+	if img.opt.CharsetSplits != "" {
+		return screen, nil, fmt.Errorf("-charset can not be combined with -charset-splits")
+	}
+	if isCharsetImage(img.opt.CharsetFile) && (img.graphicsType == multiColorCharset || img.graphicsType == mixedCharset) {
+		return screen, nil, fmt.Errorf("-charset image %q can not be used for %s, multicolor chars require a .bin or .prg charset", img.opt.CharsetFile, img.graphicsType)
+	}
+	file := img.opt.charsetFile
+	if len(file) > maxChars {
+		file = file[:maxChars]
+	}
+	used := [MaxChars]bool{}
+	if img.opt.CharsetReserve != "" {
+		if used, err = parseCharRanges(img.opt.CharsetReserve); err != nil {
+			return screen, nil, fmt.Errorf("parseCharRanges failed: %w", err)
+		}
+	} else if img.opt.CharOrder != "stable" {
+		for i := range file {
+			used[i] = true
+		}
+	}
+
+	charset = make([]charBytes, maxChars)
+	copy(charset, file)
+	slot := [FullScreenChars]int{}
+	newChars := []charBytes{}
+	reused := map[int]bool{}
+	for char, cbuf := range cbufs {
+		slot[char] = slices.Index(file, cbuf)
+		if slot[char] >= 0 {
+			used[slot[char]] = true
+			reused[slot[char]] = true
+			continue
+		}
+		if !In(newChars, cbuf) {
+			newChars = append(newChars, cbuf)
+		}
+	}
+
+	free := []int{}
+	for i := 0; i < maxChars; i++ {
+		if !used[i] {
+			free = append(free, i)
+		}
+	}
+	if len(newChars) > len(free) {
+		return screen, nil, fmt.Errorf("%d new chars do not fit into the %d free slots of charset %q (reused %d chars), use -charset-reserve to free up slots", len(newChars), len(free), img.opt.CharsetFile, len(reused))
+	}
+
+	last := len(file) - 1
+	for char, cbuf := range cbufs {
+		if slot[char] < 0 {
+			slot[char] = free[slices.Index(newChars, cbuf)]
+			charset[slot[char]] = cbuf
+		}
+		screen[char] = byte(slot[char])
+		if slot[char] > last {
+			last = slot[char]
+		}
+	}
+	if !img.opt.Quiet {
+		fmt.Printf("reused %d chars of charset %q and added %d new chars, %d free slots left\n", len(reused), img.opt.CharsetFile, len(newChars), len(free)-len(newChars))
+	}
+	return screen, charset[:last+1], nil
+}
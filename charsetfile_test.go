@@ -0,0 +1,72 @@
+package png2prg
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCharRanges(t *testing.T) {
+	t.Parallel()
+	type tc struct {
+		in      string
+		want    []int
+		wantErr bool
+	}
+	testCases := []tc{
+		{"0", []int{0}, false},
+		{"0-3", []int{0, 1, 2, 3}, false},
+		{"0-1, 128,255", []int{0, 1, 128, 255}, false},
+		{"3-3", []int{3}, false},
+		{"256", nil, true},
+		{"-1", nil, true},
+		{"4-2", nil, true},
+		{"a-b", nil, true},
+		{"", nil, true},
+	}
+	for _, c := range testCases {
+		got, err := parseCharRanges(c.in)
+		if c.wantErr {
+			assert.NotNil(t, err, c.in)
+			continue
+		}
+		assert.Nil(t, err, c.in)
+		var slots []int
+		for i, used := range got {
+			if used {
+				slots = append(slots, i)
+			}
+		}
+		assert.Equal(t, c.want, slots, c.in)
+	}
+}
+
+func TestImageToCharBytes(t *testing.T) {
+	t.Parallel()
+	black, white := color.RGBA{0, 0, 0, 0xff}, color.RGBA{0xff, 0xff, 0xff, 0xff}
+	im := image.NewRGBA(image.Rect(0, 0, 16, 8))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 16; x++ {
+			im.Set(x, y, black)
+		}
+	}
+	// char 0 has a vertical line at x=0, char 1 a horizontal line at y=7.
+	for i := 0; i < 8; i++ {
+		im.Set(0, i, white)
+		im.Set(8+i, 7, white)
+	}
+	cb, err := imageToCharBytes(im)
+	require.Nil(t, err)
+	assert.Equal(t, []charBytes{
+		{0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80},
+		{0, 0, 0, 0, 0, 0, 0, 0xff},
+	}, cb)
+
+	_, err = imageToCharBytes(image.NewRGBA(image.Rect(0, 0, 12, 8)))
+	assert.NotNil(t, err)
+	assert.True(t, isCharsetImage("chars.PNG"))
+	assert.False(t, isCharsetImage("chars.prg"))
+}
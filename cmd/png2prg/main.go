@@ -84,6 +84,11 @@ func processAsOne(opt *png2prg.Options, filenames ...string) error {
 	if len(filenames) > 0 {
 		opt.OutFile = png2prg.DestinationFilename(filenames[0], *opt)
 	}
+	for _, filename := range filenames {
+		if isSameFile(opt.OutFile, filename) {
+			return fmt.Errorf("refusing to overwrite input file %q", filename)
+		}
+	}
 	opt.CurrentGraphicsType = png2prg.StringToGraphicsType(opt.GraphicsMode)
 
 	if altOffset {
@@ -195,6 +200,19 @@ func worker(i int, opt png2prg.Options, wg *sync.WaitGroup, jobs <-chan string)
 	}
 }
 
+// isSameFile returns true if both files exist and are the same file.
+func isSameFile(a, b string) bool {
+	fa, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	fb, err := os.Stat(b)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(fa, fb)
+}
+
 func writeMemProfile(path string) error {
 	f, err := os.Create(path)
 	if err != nil {
@@ -253,9 +271,11 @@ func initAndParseFlags() (opt png2prg.Options) {
 	flag.StringVar(&opt.TargetDir, "td", "", "targetdir")
 	flag.StringVar(&opt.TargetDir, "targetdir", "", "specify targetdir")
 	flag.StringVar(&opt.GraphicsMode, "m", "", "mode")
-	flag.StringVar(&opt.GraphicsMode, "mode", "", "force graphics mode to koala, hires, mixedcharset, sccharset, mccharset (4col), scsprites or mcsprites")
+	flag.StringVar(&opt.GraphicsMode, "mode", "", "force graphics mode to koala, hires, mixedcharset, sccharset, mccharset (4col), petscii, ecm, ecmpetscii, scsprites, mcsprites, mixedsprites or layeredsprites")
 	flag.BoolVar(&opt.Interlace, "i", false, "interlace")
-	flag.BoolVar(&opt.Interlace, "interlace", false, "when you supply 2 frames, specify -interlace to treat the images as such")
+	flag.BoolVar(&opt.Interlace, "interlace", false, "when you supply 2 frames, specify -interlace to treat the images as such, use -mode hires -interlace for hires interlace (2 frames or 1 image with blended colors)")
+	flag.BoolVar(&opt.Blended, "bl", false, "blended")
+	flag.BoolVar(&opt.Blended, "blended", false, "split 1 image with blended colors into 2 interlace frames, implies -interlace and -d016 0")
 	flag.IntVar(&opt.D016Offset, "d016", 1, "d016offset")
 	flag.IntVar(&opt.D016Offset, "d016offset", 1, "number of pixels to shift with d016 when using interlace")
 	flag.StringVar(&opt.BitpairColorsString, "bpc", "", "bitpair-colors")
@@ -274,6 +294,62 @@ func initAndParseFlags() (opt png2prg.Options) {
 	flag.BoolVar(&opt.NoPackEmptyChar, "no-pack-empty", false, "do not optimize packing empty chars (only for mc/mixed/ecm charset)")
 	flag.BoolVar(&opt.ForcePackEmptyChar, "fpe", false, "force-pack-empty")
 	flag.BoolVar(&opt.ForcePackEmptyChar, "force-pack-empty", false, "optimize packing empty chars (only for sccharset)")
+	flag.StringVar(&opt.SplitScreen, "ss", "", "split-screen")
+	flag.StringVar(&opt.SplitScreen, "split-screen", "", "convert a bitmap and a charset region of the image, split at a char row, eg koala,18,petscii or sccharset,5,hires (no displayer support)")
+	flag.StringVar(&opt.Font, "fnt", "", "font")
+	flag.StringVar(&opt.Font, "font", "", "convert a font sheet of 1x1, 1x2, 2x1 or 2x2 char glyphs to a charset in screencode order, use -mode mccharset for multicolor fonts")
+	flag.StringVar(&opt.FontMap, "fm", "", "font-map")
+	flag.StringVar(&opt.FontMap, "font-map", "", "the ascii chars of the glyphs in the font sheet, eg \" ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789.,!?\" (default screencode order)")
+	flag.BoolVar(&opt.Petsciify, "pet", false, "petsciify")
+	flag.BoolVar(&opt.Petsciify, "petsciify", false, "lossy conversion of any 320x200 image to petscii, picking the best matching rom char and color per char")
+	flag.StringVar(&opt.PetsciifyMetric, "petm", "", "petsciify-metric")
+	flag.StringVar(&opt.PetsciifyMetric, "petsciify-metric", "", "compare chars by pixel (default) or structure (2x2 pixel block averages) error")
+	flag.StringVar(&opt.PetsciifyPreview, "petp", "", "petsciify-preview")
+	flag.StringVar(&opt.PetsciifyPreview, "petsciify-preview", "", "write a png `file` preview of the petsciified image")
+	flag.StringVar(&opt.ROMCharsets, "rom", "", "rom-charsets")
+	flag.StringVar(&opt.ROMCharsets, "rom-charsets", "", "detect petscii using these comma separated rom charsets in order, builtin uppercase/lowercase or charset files (.bin, .prg or image) (default uppercase,lowercase)")
+	flag.StringVar(&opt.PETSCIIExport, "pex", "", "petscii-export")
+	flag.StringVar(&opt.PETSCIIExport, "petscii-export", "", "write petscii as petmate (.petmate), marq (PETSCII editor .c source), pet (.pet) document, seq (.seq stream) or basic (print program) instead of .prg")
+	flag.IntVar(&opt.SpriteMargin, "spm", 0, "sprite-margin")
+	flag.IntVar(&opt.SpriteMargin, "sprite-margin", 0, "skip `n` pixels at the top and left of the sprite sheet")
+	flag.IntVar(&opt.SpriteSpacing, "sps", 0, "sprite-spacing")
+	flag.IntVar(&opt.SpriteSpacing, "sprite-spacing", 0, "skip `n` pixels between the sprites of the sheet, eg 1 for grid lines")
+	flag.BoolVar(&opt.SpriteColumnMajor, "spc", false, "sprite-column-major")
+	flag.BoolVar(&opt.SpriteColumnMajor, "sprite-column-major", false, "read the sprites (or objects) of the sheet top to bottom, then left to right")
+	flag.StringVar(&opt.SpriteRect, "spr", "", "sprite-rect")
+	flag.StringVar(&opt.SpriteRect, "sprite-rect", "", "only read the sprites in this part of the sheet, x,y,width,height in pixels, eg 0,0,100,44")
+	flag.StringVar(&opt.SpriteObjects, "spo", "", "sprite-objects")
+	flag.StringVar(&opt.SpriteObjects, "sprite-objects", "", "group the sprites in objects of wxh sprites, stored consecutively, eg 2x2")
+	flag.StringVar(&opt.SpriteExpand, "spx", "", "sprite-expand")
+	flag.StringVar(&opt.SpriteExpand, "sprite-expand", "", "reduce x and/or y expanded sprites with doubled pixels to native sprites: auto, none, x, y or xy (default none)")
+	flag.BoolVar(&opt.SpriteDedup, "spd", false, "sprite-dedup")
+	flag.BoolVar(&opt.SpriteDedup, "sprite-dedup", false, "store identical sprites once, with a sprite index table (no displayer support)")
+	flag.BoolVar(&opt.SpriteMirror, "spmi", false, "sprite-mirror")
+	flag.BoolVar(&opt.SpriteMirror, "sprite-mirror", false, "like -sprite-dedup, also storing horizontally mirrored sprites once, bit 7 of the index is set for mirrored sprites")
+	flag.BoolVar(&opt.SpriteTrim, "spt", false, "sprite-trim")
+	flag.BoolVar(&opt.SpriteTrim, "sprite-trim", false, "skip empty sprites, with index $ff in the sprite index table (no displayer support)")
+	flag.StringVar(&opt.SpriteAddress, "spa", "", "sprite-address")
+	flag.StringVar(&opt.SpriteAddress, "sprite-address", "", "load address of the sprites, 64 byte aligned, eg $3000 or 0x8000 (default $2000, no displayer support)")
+	flag.StringVar(&opt.SpriteNames, "spn", "", "sprite-names")
+	flag.StringVar(&opt.SpriteNames, "sprite-names", "", "name the sprite pointer symbols after the names in this .csv or .yaml file, eg walk0 results in sprite_walk0")
+	flag.BoolVar(&opt.SpriteOverlay, "so", false, "sprite-overlay")
+	flag.BoolVar(&opt.SpriteOverlay, "sprite-overlay", false, "move the colors that exceed the limit per char of koala or hires to an overlay of singlecolor sprites (no displayer support)")
+	flag.StringVar(&opt.CharOrder, "co", "", "char-order")
+	flag.StringVar(&opt.CharOrder, "char-order", "", "order packed chars by appearance (default), frequency, similarity or stable (requires -charset of the previous conversion)")
+	flag.IntVar(&opt.MaxUniqueChars, "maxc", 0, "max-chars")
+	flag.IntVar(&opt.MaxUniqueChars, "max-chars", 0, "merge the most similar chars until the charset packs to max `n` chars, altering some pixels (only for sc/mc/mixed/ecm charset)")
+	flag.StringVar(&opt.MaxUniqueCharsDiff, "maxcd", "", "max-chars-diff")
+	flag.StringVar(&opt.MaxUniqueCharsDiff, "max-chars-diff", "", "write a png `file` with the pixels altered by -max-chars in red")
+	flag.StringVar(&opt.CharsetFile, "cf", "", "charset")
+	flag.StringVar(&opt.CharsetFile, "charset", "", "convert using an existing charset `file` (.bin, .prg or image), reusing its chars and adding new chars in free slots (only for sc/mc/mixed/ecm charset)")
+	flag.StringVar(&opt.CharsetReserve, "cr", "", "charset-reserve")
+	flag.StringVar(&opt.CharsetReserve, "charset-reserve", "", "only keep these chars of the -charset file, the other slots are free for new chars, eg 0-63,128")
+	flag.BoolVar(&opt.SharedCharset, "shc", false, "shared-charset")
+	flag.BoolVar(&opt.SharedCharset, "shared-charset", false, "convert multiple images to independent screens sharing 1 packed charset (only for sc/mc/mixed charset, no displayer support)")
+	flag.StringVar(&opt.CharsetSplits, "cs", "", "charset-splits")
+	flag.StringVar(&opt.CharsetSplits, "charset-splits", "", "split the screen in max 3 horizontal bands with a charset each, either auto or the char rows where a band starts, eg 8,16 (only for sc/mc/mixed charset, no displayer support)")
+	flag.BoolVar(&opt.RowColors, "rc", false, "row-colors")
+	flag.BoolVar(&opt.RowColors, "row-colors", false, "solve d022/d023 colors per char row, for raster splits in mc/mixed charset (no displayer support)")
 	flag.BoolVar(&opt.NoPrevCharColors, "npcc", false, "no-prev-char-colors")
 	flag.BoolVar(&opt.NoPrevCharColors, "no-prev-char-colors", false, "do not look at the previous char's bitpair-colors, in some cases this optimization causes worse pack results")
 	flag.BoolVar(&opt.NoBitpairCounters, "nbc", false, "no-bitpair-counters")
@@ -54,6 +54,9 @@ func (c C64Color) String() string {
 	}
 }
 
+// lumaLevels contains the 9 luminance levels of the VIC-II for each C64Color.
+var lumaLevels = [MaxColors]int{0, 8, 2, 6, 3, 5, 1, 7, 3, 1, 5, 2, 4, 7, 4, 6}
+
 // A Color contains a mapped C64Color and its embedded color.Color value, usually a color.RGBA.
 type Color struct {
 	color.Color
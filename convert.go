@@ -6,6 +6,8 @@ import (
 	"log"
 	"slices"
 	"sort"
+	"strconv"
+	"strings"
 )
 
 // In returns true if element v is equal to an element of slice s.
@@ -331,6 +333,36 @@ func newBitpairsFromBPColors(bpc BPColors) *bitpairs {
 	return bp
 }
 
+// d800Bitpairs returns a copy of the shared bitpairs 00, 01 and 10 of bp, with bitpair 11 set to the remaining color of the char.
+// This is the individual d800 color of the char, if the char does not have a remaining color, bitpair 11 of bp is used.
+func (img *sourceImage) d800Bitpairs(char int, bp *bitpairs) (*bitpairs, error) {
+	out := &bitpairs{}
+	for i := byte(0); i < 3; i++ {
+		if col, ok := bp.color(i); ok {
+			out.add(i, col)
+		}
+	}
+	x, y := xyFromChar(char)
+	for _, col := range img.charColors[char] {
+		if _, ok := out.bitpair(col); ok {
+			continue
+		}
+		if prev, ok := out.color(3); ok {
+			return nil, fmt.Errorf("too many colors in char %d (x=%d y=%d): %s and %s both need bitpair 11", char, x, y, prev, col)
+		}
+		if col.C64Color > 7 {
+			return nil, fmt.Errorf("d800 color %s in char %d (x=%d y=%d) must be 0-7", col, char, x, y)
+		}
+		out.add(3, col)
+	}
+	if _, ok := out.color(3); !ok {
+		if col, ok := bp.color(3); ok {
+			out.add(3, col)
+		}
+	}
+	return out, nil
+}
+
 // multiColorCharBytes converts the char to charBytes.
 func (img *sourceImage) multiColorCharBytes(char int, bp *bitpairs) (charBytes, error) {
 	b := charBytes{}
@@ -547,6 +579,16 @@ LOOP:
 
 	if img.opt.NoPackChars {
 		for char := 0; char < MaxChars; char++ {
+			// individual d800 colors
+			bp := &bitpairs{bitpairs: []byte{0, 1}}
+			for _, col := range img.charColors[char] {
+				if col.C64Color == cc[0].C64Color {
+					bp.add(0, col)
+				} else {
+					bp.add(1, col)
+					c.D800Color[char] = byte(col.C64Color)
+				}
+			}
 			cbuf, err := img.singleColorCharBytes(char, bp)
 			if err != nil {
 				x, y := xyFromChar(char)
@@ -567,6 +609,7 @@ LOOP:
 			log.Printf("using prebuiltCharset of %d chars", len(prebuiltCharset))
 		}
 	}
+	cbufs := [FullScreenChars]charBytes{}
 
 	truecount := map[charBytes]int{}
 	for char := 0; char < FullScreenChars; char++ {
@@ -593,6 +636,7 @@ LOOP:
 			}
 		}
 		truecount[cbuf]++
+		cbufs[char] = cbuf
 		curChar := slices.Index(charset, cbuf)
 		if curChar < 0 {
 			charset = append(charset, cbuf)
@@ -601,6 +645,31 @@ LOOP:
 		c.Screen[char] = byte(curChar)
 	}
 
+	if img.opt.MaxUniqueChars > 0 {
+		var err error
+		if c.Screen, charset, err = img.reduceChars(&cbufs, [FullScreenChars]bool{}, prebuiltCharset, MaxChars); err != nil {
+			return c, fmt.Errorf("reduceChars failed: %w", err)
+		}
+		truecount = map[charBytes]int{}
+		for _, cbuf := range cbufs {
+			truecount[cbuf]++
+		}
+	}
+	if img.opt.CharsetSplits != "" {
+		var err error
+		if c.Screen, charset, c.Bands, err = img.packCharsetBands(cbufs, prebuiltCharset); err != nil {
+			return c, fmt.Errorf("packCharsetBands failed: %w", err)
+		}
+	}
+	if img.opt.CharsetFile != "" && len(prebuiltCharset) == 0 {
+		var err error
+		if c.Screen, charset, err = img.fitCharsetFile(cbufs, MaxChars); err != nil {
+			return c, fmt.Errorf("fitCharsetFile failed: %w", err)
+		}
+	}
+	if img.opt.CharsetSplits == "" {
+		charset = img.orderChars(&c.Screen, charset, len(prebuiltCharset), 0xff)
+	}
 	if len(charset) > MaxChars {
 		return c, fmt.Errorf("image packs to %d unique chars, the max is %d.", len(charset), MaxChars)
 	}
@@ -632,27 +701,29 @@ func romCharsetToCharBytes(romPrg []byte) (cb []charBytes) {
 }
 
 // PETSCIICharset converts the img to PETSCIICharset and returns it.
+// The rom charsets are tried in order, see -rom-charsets, the first one containing all chars of the image is used.
 func (img *sourceImage) PETSCIICharset() (PETSCIICharset, error) {
 	c := PETSCIICharset{
 		SourceFilename: img.sourceFilename,
 		BorderColor:    byte(img.border.C64Color),
 		opt:            img.opt,
 	}
-	charset := romCharsetToCharBytes(romCharsetUppercasePrg)
-	scc, err := img.SingleColorCharset(charset)
-	if err == nil {
-		c.Screen = scc.Screen
-		c.D800Color = scc.D800Color
-		c.BackgroundColor = scc.BackgroundColor
-		return c, nil
-	}
-	charset = romCharsetToCharBytes(romCharsetLowercasePrg)
-	scc, err = img.SingleColorCharset(charset)
-	if err == nil {
+	var err error
+	for _, rom := range img.opt.romCharsets() {
+		var scc SingleColorCharset
+		if scc, err = img.SingleColorCharset(rom.Chars); err != nil {
+			continue
+		}
+		// chars not found in a rom charset of less than 256 chars are appended to it.
+		if i := slices.IndexFunc(scc.Screen[:], func(b byte) bool { return int(b) >= len(rom.Chars) }); i >= 0 {
+			x, y := xyFromChar(i)
+			err = fmt.Errorf("char %d (x=%d y=%d) is not found in the %s rom charset", i, x, y, rom.Name)
+			continue
+		}
+		c.ROMCharset, c.Lowercase = rom.Name, rom.Lowercase
 		c.Screen = scc.Screen
 		c.D800Color = scc.D800Color
 		c.BackgroundColor = scc.BackgroundColor
-		c.Lowercase = 1
 		return c, nil
 	}
 	return c, err
@@ -670,48 +741,121 @@ func (img *sourceImage) MultiColorCharset(prebuiltCharset []charBytes) (c MultiC
 	if len(cc) < 1 {
 		return c, fmt.Errorf("not enough colors: %v", cc)
 	}
-	img.bg = cc[0]
-	if len(img.bpc) == 0 {
-		for i := range cc {
-			col := cc[i]
-			img.bpc = append(img.bpc, &col)
+	var rowbp [FullScreenRows]*bitpairs
+	if img.opt.RowColors {
+		charcol, rows, err := img.findMultiColorRowColors()
+		if err != nil {
+			return c, fmt.Errorf("findMultiColorRowColors failed: %w", err)
+		}
+		img.bg = *rows[0][0]
+		c.BackgroundColor = byte(img.bg.C64Color)
+		if charcol != nil {
+			c.CharColor = byte(charcol.C64Color) | 8
+			for i := 0; i < FullScreenChars; i++ {
+				c.D800Color[i] = c.CharColor
+			}
+		}
+		for row := range rows {
+			rowbp[row] = newBitpairsFromBPColors(append(rows[row], charcol))
+			if col, ok := rowbp[row].color(1); ok {
+				c.RowD022Color[row] = byte(col.C64Color)
+			}
+			if col, ok := rowbp[row].color(2); ok {
+				c.RowD023Color[row] = byte(col.C64Color)
+			}
+		}
+		img.bpc = append(rows[0], charcol)
+		c.D022Color, c.D023Color = c.RowD022Color[0], c.RowD023Color[0]
+		if img.opt.Verbose {
+			log.Printf("charset colors per row: -bitpair-colors %s", img.bpc)
+		}
+	} else if img.opt.NoPackChars && len(cc) > 4 {
+		// individual d800 colors: only d021, d022 and d023 are shared, bitpair 11 is set per char.
+		fixed := BPColors{}
+		for _, col := range img.bpc {
+			if col != nil && In(img.bgCandidates, *col) && len(fixed) < 3 {
+				fixed = append(fixed, col)
+			}
+		}
+		for _, col := range img.bgCandidates {
+			if !fixed.Contains(col) && len(fixed) < 3 {
+				col := col
+				fixed = append(fixed, &col)
+			}
+		}
+		if len(fixed) == 0 {
+			return c, fmt.Errorf("no shared colors found for individual d800 colors in %d colors %v", len(cc), cc)
+		}
+		img.bg = *fixed[0]
+		img.bpc = fixed
+		bp := newBitpairsFromBPColors(fixed)
+		c.BackgroundColor = byte(img.bg.C64Color)
+		if col, ok := bp.color(1); ok {
+			c.D022Color = byte(col.C64Color)
+		}
+		if col, ok := bp.color(2); ok {
+			c.D023Color = byte(col.C64Color)
+		}
+		for row := range rowbp {
+			rowbp[row] = bp
+		}
+		if img.opt.Verbose {
+			log.Printf("charset colors with individual d800 colors: %s\n", bp.colors())
+		}
+	} else {
+		img.bg = cc[0]
+		if len(img.bpc) == 0 {
+			for i := range cc {
+				col := cc[i]
+				img.bpc = append(img.bpc, &col)
+			}
 		}
-	}
 
-	bp, err := img.newBitpairs(0, cc, false)
-	if err != nil {
-		return c, fmt.Errorf("newBitpairs failed: %w", err)
-	}
+		bp, err := img.newBitpairs(0, cc, false)
+		if err != nil {
+			return c, fmt.Errorf("newBitpairs failed: %w", err)
+		}
 
-	if img.opt.Verbose {
-		log.Printf("charset colors: %s\n", bp.colors())
-		log.Printf("bitpairs: %v\n", bp)
-	}
-	if col, ok := bp.color(3); ok {
-		if col.C64Color > 7 {
-			if !img.opt.Quiet {
-				return c, fmt.Errorf("the bitpair 11 can only contain colors 0-7, you will want to swap -bitpair-colors %s", img.bpc)
-			}
+		if img.opt.Verbose {
+			log.Printf("charset colors: %s\n", bp.colors())
+			log.Printf("bitpairs: %v\n", bp)
 		}
-		c.CharColor = byte(col.C64Color) | 8
-		for i := 0; i < FullScreenChars; i++ {
-			c.D800Color[i] = c.CharColor
+		if col, ok := bp.color(3); ok {
+			if col.C64Color > 7 {
+				if !img.opt.Quiet {
+					return c, fmt.Errorf("the bitpair 11 can only contain colors 0-7, you will want to swap -bitpair-colors %s", img.bpc)
+				}
+			}
+			c.CharColor = byte(col.C64Color) | 8
+			for i := 0; i < FullScreenChars; i++ {
+				c.D800Color[i] = c.CharColor
+			}
 		}
-	}
 
-	if col, ok := bp.color(0); ok {
-		c.BackgroundColor = byte(col.C64Color)
-	}
-	if col, ok := bp.color(1); ok {
-		c.D022Color = byte(col.C64Color)
-	}
-	if col, ok := bp.color(2); ok {
-		c.D023Color = byte(col.C64Color)
+		if col, ok := bp.color(0); ok {
+			c.BackgroundColor = byte(col.C64Color)
+		}
+		if col, ok := bp.color(1); ok {
+			c.D022Color = byte(col.C64Color)
+		}
+		if col, ok := bp.color(2); ok {
+			c.D023Color = byte(col.C64Color)
+		}
+		for row := range rowbp {
+			rowbp[row] = bp
+		}
 	}
 	c.BorderColor = byte(img.border.C64Color)
 
 	if img.opt.NoPackChars {
 		for char := 0; char < MaxChars; char++ {
+			bp, err := img.d800Bitpairs(char, rowbp[char/40])
+			if err != nil {
+				return c, fmt.Errorf("d800Bitpairs failed: %w", err)
+			}
+			if col, ok := bp.color(3); ok {
+				c.D800Color[char] = byte(col.C64Color) | 8
+			}
 			cbuf, err := img.multiColorCharBytes(char, bp)
 			if err != nil {
 				x, y := xyFromChar(char)
@@ -732,8 +876,9 @@ func (img *sourceImage) MultiColorCharset(prebuiltCharset []charBytes) (c MultiC
 			log.Printf("using prebuiltCharset of %d chars", len(prebuiltCharset))
 		}
 	}
+	cbufs := [FullScreenChars]charBytes{}
 	for char := 0; char < FullScreenChars; char++ {
-		cbuf, err := img.multiColorCharBytes(char, bp)
+		cbuf, err := img.multiColorCharBytes(char, rowbp[char/40])
 		if err != nil {
 			x, y := xyFromChar(char)
 			return c, fmt.Errorf("multiColorCharBytes failed: error in char %d (x=%d y=%d): %w", char, x, y, err)
@@ -745,6 +890,7 @@ func (img *sourceImage) MultiColorCharset(prebuiltCharset []charBytes) (c MultiC
 				c.D800Color[char] = c.BackgroundColor
 			}
 		}
+		cbufs[char] = cbuf
 		curChar := slices.Index(charset, cbuf)
 		if curChar < 0 {
 			charset = append(charset, cbuf)
@@ -753,6 +899,28 @@ func (img *sourceImage) MultiColorCharset(prebuiltCharset []charBytes) (c MultiC
 		c.Screen[char] = byte(curChar)
 	}
 
+	if img.opt.MaxUniqueChars > 0 {
+		mc := [FullScreenChars]bool{}
+		for char := range mc {
+			mc[char] = true
+		}
+		if c.Screen, charset, err = img.reduceChars(&cbufs, mc, prebuiltCharset, MaxChars); err != nil {
+			return c, fmt.Errorf("reduceChars failed: %w", err)
+		}
+	}
+	if img.opt.CharsetSplits != "" {
+		if c.Screen, charset, c.Bands, err = img.packCharsetBands(cbufs, prebuiltCharset); err != nil {
+			return c, fmt.Errorf("packCharsetBands failed: %w", err)
+		}
+	}
+	if img.opt.CharsetFile != "" && len(prebuiltCharset) == 0 {
+		if c.Screen, charset, err = img.fitCharsetFile(cbufs, MaxChars); err != nil {
+			return c, fmt.Errorf("fitCharsetFile failed: %w", err)
+		}
+	}
+	if img.opt.CharsetSplits == "" {
+		charset = img.orderChars(&c.Screen, charset, len(prebuiltCharset), 0xff)
+	}
 	if len(charset) > MaxChars {
 		return c, fmt.Errorf("image packs to %d unique chars, the max is %d.", len(charset), MaxChars)
 	}
@@ -840,16 +1008,35 @@ func (img *sourceImage) MixedCharset(prebuiltCharset []charBytes) (c MixedCharse
 		img.bpc = fixpref
 	}
 
+	var rows [FullScreenRows]BPColors
+	if img.opt.RowColors {
+		if len(img.bpc) == 0 || img.bpc[0] == nil {
+			return c, fmt.Errorf("no background color found for mixed charset row colors")
+		}
+		if rows, err = img.findRowColors(*img.bpc[0], nil, true); err != nil {
+			return c, fmt.Errorf("findRowColors failed: %w", err)
+		}
+		for row := range rows {
+			if col := rows[row][1]; col != nil {
+				c.RowD022Color[row] = byte(col.C64Color)
+			}
+			if col := rows[row][2]; col != nil {
+				c.RowD023Color[row] = byte(col.C64Color)
+			}
+		}
+		img.bpc = rows[0]
+	}
+
 	if img.opt.Verbose {
 		log.Printf("img.MixedCharset: img.bpc: %v", img.bpc)
 	}
-	if len(img.bpc) > 0 {
+	if len(img.bpc) > 0 && img.bpc[0] != nil {
 		c.BackgroundColor = byte(img.bpc[0].C64Color)
 	}
-	if len(img.bpc) > 1 {
+	if len(img.bpc) > 1 && img.bpc[1] != nil {
 		c.D022Color = byte(img.bpc[1].C64Color)
 	}
-	if len(img.bpc) > 2 {
+	if len(img.bpc) > 2 && img.bpc[2] != nil {
 		c.D023Color = byte(img.bpc[2].C64Color)
 	}
 	if len(img.bpc) > 3 {
@@ -863,20 +1050,25 @@ func (img *sourceImage) MixedCharset(prebuiltCharset []charBytes) (c MixedCharse
 			log.Printf("using prebuiltCharset of %d chars", len(prebuiltCharset))
 		}
 	}
+	cbufs := [FullScreenChars]charBytes{}
 	for char := 0; char < FullScreenChars; char++ {
+		bpc := img.bpc
+		if img.opt.RowColors {
+			bpc = rows[char/40]
+		}
 		bp := &bitpairs{bitpairs: []byte{0, 1, 2, 3}}
-		if len(img.bpc) > 0 {
-			if col := img.bpc[0]; col != nil {
+		if len(bpc) > 0 {
+			if col := bpc[0]; col != nil {
 				bp.add(0, *col)
 			}
 		}
-		if len(img.bpc) > 1 {
-			if col := img.bpc[1]; col != nil {
+		if len(bpc) > 1 {
+			if col := bpc[1]; col != nil {
 				bp.add(1, *col)
 			}
 		}
-		if len(img.bpc) > 2 {
-			if col := img.bpc[2]; col != nil {
+		if len(bpc) > 2 {
+			if col := bpc[2]; col != nil {
 				bp.add(2, *col)
 			}
 		}
@@ -947,12 +1139,13 @@ func (img *sourceImage) MixedCharset(prebuiltCharset []charBytes) (c MixedCharse
 			}
 		}
 
-		if !img.opt.NoPackEmptyChar {
+		if !img.opt.NoPackEmptyChar && !img.opt.NoPackChars {
 			if cbuf == emptyChar && c.BackgroundColor < 8 {
 				cbuf = charBytes{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
 				c.D800Color[char] = c.BackgroundColor
 			}
 		}
+		cbufs[char] = cbuf
 		curChar := slices.Index(charset, cbuf)
 		if curChar < 0 {
 			charset = append(charset, cbuf)
@@ -961,6 +1154,43 @@ func (img *sourceImage) MixedCharset(prebuiltCharset []charBytes) (c MixedCharse
 		c.Screen[char] = byte(curChar)
 	}
 
+	if img.opt.NoPackChars {
+		for char := 0; char < FullScreenChars; char++ {
+			c.Screen[char] = 0
+			if char < MaxChars {
+				for i := range cbufs[char] {
+					c.Bitmap[char*8+i] = cbufs[char][i]
+				}
+				c.Screen[char] = byte(char)
+			}
+		}
+		if !img.opt.Quiet {
+			fmt.Printf("settled for -bitpair-colors %s\n", img.bpc)
+		}
+		return c, nil
+	}
+	if img.opt.MaxUniqueChars > 0 {
+		mc := [FullScreenChars]bool{}
+		for char := range mc {
+			mc[char] = c.D800Color[char]&8 != 0
+		}
+		if c.Screen, charset, err = img.reduceChars(&cbufs, mc, prebuiltCharset, MaxChars); err != nil {
+			return c, fmt.Errorf("reduceChars failed: %w", err)
+		}
+	}
+	if img.opt.CharsetSplits != "" {
+		if c.Screen, charset, c.Bands, err = img.packCharsetBands(cbufs, prebuiltCharset); err != nil {
+			return c, fmt.Errorf("packCharsetBands failed: %w", err)
+		}
+	}
+	if img.opt.CharsetFile != "" && len(prebuiltCharset) == 0 {
+		if c.Screen, charset, err = img.fitCharsetFile(cbufs, MaxChars); err != nil {
+			return c, fmt.Errorf("fitCharsetFile failed: %w", err)
+		}
+	}
+	if img.opt.CharsetSplits == "" {
+		charset = img.orderChars(&c.Screen, charset, len(prebuiltCharset), 0xff)
+	}
 	if len(charset) > MaxChars {
 		return c, fmt.Errorf("image packs to %d unique chars, the max is %d.", len(charset), MaxChars)
 	}
@@ -978,6 +1208,99 @@ func (img *sourceImage) MixedCharset(prebuiltCharset []charBytes) (c MixedCharse
 	return c, err
 }
 
+// parseCharsetSplits parses the -charset-splits string, either "auto" or comma separated char rows, eg "8,16".
+// For "auto" it returns nil.
+func parseCharsetSplits(in string) (rows []int, err error) {
+	if in == "auto" {
+		return nil, nil
+	}
+	for _, v := range strings.Split(in, ",") {
+		row, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil {
+			return nil, fmt.Errorf("strconv.Atoi conversion of %q to integers failed: %w", in, err)
+		}
+		if row < 1 || row >= FullScreenRows {
+			return nil, fmt.Errorf("incorrect char row %d, it must be between 1 and %d", row, FullScreenRows-1)
+		}
+		if len(rows) > 0 && row <= rows[len(rows)-1] {
+			return nil, fmt.Errorf("char rows must be in ascending order: %q", in)
+		}
+		rows = append(rows, row)
+	}
+	if len(rows) >= MaxCharsetBands {
+		return nil, fmt.Errorf("too many char rows %q, the max is %d", in, MaxCharsetBands-1)
+	}
+	return rows, nil
+}
+
+// packCharsetBands packs cbufs into one charset per horizontal band of char rows, according to img.opt.CharsetSplits.
+// In auto mode, a new band starts at the first char row that does not fit in the current charset.
+// It returns the screen, the charset of the first band and the remaining bands.
+func (img *sourceImage) packCharsetBands(cbufs [FullScreenChars]charBytes, prebuiltCharset []charBytes) (screen [FullScreenChars]byte, charset []charBytes, bands []CharsetBand, err error) {
+	if img.opt.RowColors {
+		return screen, nil, nil, fmt.Errorf("-charset-splits can not be combined with -row-colors")
+	}
+	splits, err := parseCharsetSplits(img.opt.CharsetSplits)
+	if err != nil {
+		return screen, nil, nil, fmt.Errorf("parseCharsetSplits failed: %w", err)
+	}
+	packRow := func(charset []charBytes, row int) []charBytes {
+		for char := row * 40; char < row*40+40; char++ {
+			if !In(charset, cbufs[char]) {
+				charset = append(charset, cbufs[char])
+			}
+		}
+		return charset
+	}
+
+	charsets := [][]charBytes{slices.Clone(prebuiltCharset)}
+	rows := []int{0}
+	for row := 0; row < FullScreenRows; row++ {
+		cur := len(charsets) - 1
+		next := packRow(slices.Clone(charsets[cur]), row)
+		newBand := In(splits, row)
+		if splits == nil && len(next) > MaxChars && row > rows[cur] {
+			newBand = true
+		}
+		if newBand {
+			if len(charsets) == MaxCharsetBands {
+				return screen, nil, nil, fmt.Errorf("image needs more than %d charset bands", MaxCharsetBands)
+			}
+			charsets = append(charsets, packRow(nil, row))
+			rows = append(rows, row)
+			continue
+		}
+		charsets[cur] = next
+	}
+
+	for band, cs := range charsets {
+		if len(cs) > MaxChars {
+			return screen, nil, nil, fmt.Errorf("charset band %d starting at char row %d packs to %d unique chars, the max is %d", band, rows[band], len(cs), MaxChars)
+		}
+		end := FullScreenRows
+		if band < len(rows)-1 {
+			end = rows[band+1]
+		}
+		for char := rows[band] * 40; char < end*40; char++ {
+			screen[char] = byte(slices.Index(cs, cbufs[char]))
+		}
+		if !img.opt.Quiet {
+			fmt.Printf("used %d unique chars in charset band %d (char rows %d-%d)\n", len(cs), band, rows[band], end-1)
+		}
+		if band == 0 {
+			continue
+		}
+		b := CharsetBand{Row: rows[band]}
+		for i := range cs {
+			for j := range cs[i] {
+				b.Bitmap[i*8+j] = cs[i][j]
+			}
+		}
+		bands = append(bands, b)
+	}
+	return screen, charsets[0], bands, nil
+}
+
 // ECMCharset converts the img to ECMCharset and returns it.
 func (img *sourceImage) ECMCharset(prebuiltCharset []charBytes) (ECMCharset, error) {
 	if len(img.ecmColors) < 4 {
@@ -1010,8 +1333,11 @@ func (img *sourceImage) ECMCharset(prebuiltCharset []charBytes) (ECMCharset, err
 		}
 	}
 
+	numPrebuilt := len(charset)
 	emptyChar := charBytes{}
 	truecount := make(map[charBytes]int, MaxECMChars)
+	cbufs := [FullScreenChars]charBytes{}
+	orchars := [FullScreenChars]byte{}
 	for char := 0; char < FullScreenChars; char++ {
 		x, y := xyFromChar(char)
 		if len(img.charColors[char]) > 2 {
@@ -1089,6 +1415,7 @@ func (img *sourceImage) ECMCharset(prebuiltCharset []charBytes) (ECMCharset, err
 			}
 		}
 		c.Screen[char] = byte(curChar) + orchar
+		cbufs[char], orchars[char] = charset[curChar], orchar
 	}
 
 	// detect flippers
@@ -1115,6 +1442,31 @@ func (img *sourceImage) ECMCharset(prebuiltCharset []charBytes) (ECMCharset, err
 		}
 	}
 
+	if img.opt.MaxUniqueChars > 0 {
+		screen, cs, err := img.reduceChars(&cbufs, [FullScreenChars]bool{}, charset[:numPrebuilt], MaxECMChars)
+		if err != nil {
+			return c, fmt.Errorf("reduceChars failed: %w", err)
+		}
+		charset = cs
+		for char := range screen {
+			c.Screen[char] = screen[char] + orchars[char]
+		}
+		truecount = make(map[charBytes]int, MaxECMChars)
+		for _, cbuf := range charset[numPrebuilt:] {
+			truecount[cbuf]++
+		}
+	}
+	if img.opt.CharsetFile != "" && len(prebuiltCharset) == 0 {
+		var err error
+		var screen [FullScreenChars]byte
+		if screen, charset, err = img.fitCharsetFile(cbufs, MaxECMChars); err != nil {
+			return c, fmt.Errorf("fitCharsetFile failed: %w", err)
+		}
+		for char := range screen {
+			c.Screen[char] = screen[char] + orchars[char]
+		}
+	}
+	charset = img.orderChars(&c.Screen, charset, numPrebuilt, 0x3f)
 	if len(charset) > MaxECMChars {
 		return c, fmt.Errorf("image packs to %d unique chars, the max is %d.", len(charset), MaxECMChars)
 	}
@@ -1130,7 +1482,138 @@ func (img *sourceImage) ECMCharset(prebuiltCharset []charBytes) (ECMCharset, err
 	return c, nil
 }
 
+// spriteColorSets returns the colors used by each sprite, from left to right and top to bottom.
+func (img *sourceImage) spriteColorSets() ([]map[C64Color]bool, error) {
+	maxX, maxY := img.width/SpriteWidth, img.height/SpriteHeight
+	sets := make([]map[C64Color]bool, 0, maxX*maxY)
+	for spriteY := 0; spriteY < maxY; spriteY++ {
+		for spriteX := 0; spriteX < maxX; spriteX++ {
+			set := map[C64Color]bool{}
+			for y := 0; y < SpriteHeight; y++ {
+				for x := 0; x < SpriteWidth; x++ {
+					col, err := img.p.FromColor(img.At(spriteX*SpriteWidth+x, spriteY*SpriteHeight+y))
+					if err != nil {
+						return nil, fmt.Errorf("img.p.FromColor in sprite %d failed: %w", len(sets), err)
+					}
+					set[col.C64Color] = true
+				}
+			}
+			sets = append(sets, set)
+		}
+	}
+	return sets, nil
+}
+
+// hiresSprites returns for each sprite if it is a singlecolor sprite in mixed sprites:
+// it uses max 2 colors and has pixels of hires width.
+func (img *sourceImage) hiresSprites(sets []map[C64Color]bool) []bool {
+	maxX := img.width / SpriteWidth
+	hires := make([]bool, len(sets))
+	for i, set := range sets {
+		if len(set) > 2 {
+			continue
+		}
+		x0, y0 := (i%maxX)*SpriteWidth, (i/maxX)*SpriteHeight
+	SPRITE:
+		for y := 0; y < SpriteHeight; y++ {
+			for x := 0; x < SpriteWidth; x += 2 {
+				if img.At(x0+x, y0+y) != img.At(x0+x+1, y0+y) {
+					hires[i] = true
+					break SPRITE
+				}
+			}
+		}
+	}
+	return hires
+}
+
+// uniformSpriteColors clears the 64th byte of the sprites in bitmap and drops the color table,
+// if all sprites use the same color and mode, so the output stays compatible with earlier versions.
+// The displayer reads the 64th byte, so with -display the colors are kept.
+func uniformSpriteColors(opt Options, bitmap, colors []byte) ([]byte, []byte) {
+	if opt.Display || opt.keepSpriteColors {
+		return bitmap, colors
+	}
+	for i := 63; i < len(bitmap); i += 64 {
+		if bitmap[i] != bitmap[63] {
+			return bitmap, colors
+		}
+	}
+	for i := 63; i < len(bitmap); i += 64 {
+		bitmap[i] = 0
+	}
+	return bitmap, nil
+}
+
+// individualSpriteColors returns the individual color of each sprite: the only color of the sprite that is not shared.
+// Sprites without individual color get the most used individual color, or def if there is none.
+func (img *sourceImage) individualSpriteColors(sets []map[C64Color]bool, shared []C64Color, def C64Color) ([]C64Color, error) {
+	colors := make([]C64Color, len(sets))
+	found := make([]bool, len(sets))
+	count := [MaxColors]int{}
+	for i, set := range sets {
+		for col := range set {
+			if slices.Contains(shared, col) {
+				continue
+			}
+			if found[i] {
+				x, y := (i%(img.width/SpriteWidth))*SpriteWidth, (i/(img.width/SpriteWidth))*SpriteHeight
+				return nil, fmt.Errorf("sprite %d (x=%d y=%d) uses colors %d and %d besides the shared colors %v, the max is 1", i, x, y, colors[i], col, shared)
+			}
+			colors[i], found[i] = col, true
+			count[col]++
+		}
+	}
+	for col, n := range count {
+		if n > count[def] {
+			def = C64Color(col)
+		}
+	}
+	for i := range colors {
+		if !found[i] {
+			colors[i] = def
+		}
+	}
+	return colors, nil
+}
+
+// sharedSpriteColors finds the d025 and d026 colors shared by all multicolor sprites,
+// so that each sprite uses max 1 individual color besides them and the background color.
+func (img *sourceImage) sharedSpriteColors(sets []map[C64Color]bool) (d025, d026 C64Color, err error) {
+	bg := img.bg.C64Color
+	if len(img.bpc) > 3 && img.bpc[1] != nil && img.bpc[3] != nil {
+		d025, d026 = img.bpc[1].C64Color, img.bpc[3].C64Color
+		forced := len(strings.Split(img.opt.BitpairColorsString, ",")) > 3
+		if _, err = img.individualSpriteColors(sets, []C64Color{bg, d025, d026}, 0); err == nil || forced {
+			return d025, d026, err
+		}
+	}
+	_, _, sumColors := img.countSpriteColors()
+	best := -1
+	for _, a := range img.p.SortColors() {
+		for _, b := range img.p.SortColors() {
+			if a.C64Color >= b.C64Color || a.C64Color == bg || b.C64Color == bg {
+				continue
+			}
+			if _, err := img.individualSpriteColors(sets, []C64Color{bg, a.C64Color, b.C64Color}, 0); err != nil {
+				continue
+			}
+			if sum := sumColors[a.C64Color] + sumColors[b.C64Color]; sum > best {
+				best, d025, d026 = sum, a.C64Color, b.C64Color
+				if sumColors[d026] > sumColors[d025] {
+					d025, d026 = d026, d025
+				}
+			}
+		}
+	}
+	if best < 0 {
+		return 0, 0, fmt.Errorf("no d025/d026 colors found that leave max 1 individual color per sprite")
+	}
+	return d025, d026, nil
+}
+
 // SingleColorSprites converts the img to SingleColorSprites and returns it.
+// Each sprite has its own individual color, stored in the 64th byte of the sprite and in s.Colors, see uniformSpriteColors.
 func (img *sourceImage) SingleColorSprites() (SingleColorSprites, error) {
 	maxX := img.width / SpriteWidth
 	maxY := img.height / SpriteHeight
@@ -1138,6 +1621,8 @@ func (img *sourceImage) SingleColorSprites() (SingleColorSprites, error) {
 		SourceFilename: img.sourceFilename,
 		Columns:        byte(maxX),
 		Rows:           byte(maxY),
+		ExpandX:        img.expand.x,
+		ExpandY:        img.expand.y,
 		opt:            img.opt,
 	}
 	if maxX == 0 || maxY == 0 {
@@ -1161,24 +1646,35 @@ func (img *sourceImage) SingleColorSprites() (SingleColorSprites, error) {
 		}
 	}
 
-	bp := &bitpairs{bitpairs: []byte{0, 1}}
 	s.BackgroundColor = byte(cc[0].C64Color)
-	bp.add(0, cc[0])
 	if len(cc) > 1 {
 		s.SpriteColor = byte(cc[1].C64Color)
-		bp.add(1, cc[1])
+	}
+	sets, err := img.spriteColorSets()
+	if err != nil {
+		return s, fmt.Errorf("img.spriteColorSets failed: %w", err)
+	}
+	colors, err := img.individualSpriteColors(sets, []C64Color{cc[0].C64Color}, C64Color(s.SpriteColor))
+	if err != nil {
+		return s, fmt.Errorf("img.individualSpriteColors failed: %w", err)
 	}
 	if len(cc) > 2 {
-		return s, fmt.Errorf("Too many colors.")
+		s.SpriteColor = byte(colors[0])
 	}
 
 	if img.opt.Verbose {
 		log.Printf("sprite colors: %v\n", cc)
-		log.Printf("bitpairs: %v\n", bp)
+		log.Printf("individual sprite colors: %v\n", colors)
 	}
 
 	for spriteY := 0; spriteY < maxY; spriteY++ {
 		for spriteX := 0; spriteX < maxX; spriteX++ {
+			col := colors[spriteY*maxX+spriteX]
+			bp := &bitpairs{bitpairs: []byte{0, 1}}
+			bp.add(0, cc[0])
+			if c, err := img.p.FromC64(col); err == nil {
+				bp.add(1, c)
+			}
 			for y := 0; y < SpriteHeight; y++ {
 				yOffset := y + spriteY*SpriteHeight
 				for x := 0; x < 3; x++ {
@@ -1195,9 +1691,21 @@ func (img *sourceImage) SingleColorSprites() (SingleColorSprites, error) {
 					s.Bitmap = append(s.Bitmap, bmpbyte)
 				}
 			}
-			s.Bitmap = append(s.Bitmap, 0)
+			// SpritePad convention: individual color in the low nibble of the 64th byte.
+			s.Bitmap = append(s.Bitmap, byte(col))
+			s.Colors = append(s.Colors, byte(col))
 		}
 	}
+	if s.ObjectWidth, s.ObjectHeight, err = spriteObjects(img.opt); err != nil {
+		return s, fmt.Errorf("spriteObjects failed: %w", err)
+	}
+	if s.Bitmap, s.Colors, s.Index, err = dedupSprites(img.opt, s.Bitmap, s.Colors); err != nil {
+		return s, fmt.Errorf("dedupSprites failed: %w", err)
+	}
+	s.Bitmap, s.Colors = uniformSpriteColors(img.opt, s.Bitmap, s.Colors)
+	if err = checkSpriteMemory(img.opt, len(s.Bitmap), spritePositions(img.opt, s.Bitmap, s.Index)); err != nil {
+		return s, fmt.Errorf("checkSpriteMemory failed: %w", err)
+	}
 	if !img.opt.Quiet {
 		fmt.Printf("converted %d sprites\n", maxX*maxY)
 	}
@@ -1206,50 +1714,133 @@ func (img *sourceImage) SingleColorSprites() (SingleColorSprites, error) {
 }
 
 // MultiColorSprites converts the img to MultiColorSprites and returns it.
+// The background, d025 and d026 colors are shared, each sprite has its own individual color,
+// stored in the 64th byte of the sprite with the multicolor flag and in s.Colors, see uniformSpriteColors.
+// For mixedSprites, the singlecolor sprites with hires pixels are marked in s.Hires and stored without multicolor flag.
 func (img *sourceImage) MultiColorSprites() (MultiColorSprites, error) {
 	s := MultiColorSprites{
 		SourceFilename: img.sourceFilename,
+		ExpandX:        img.expand.x,
+		ExpandY:        img.expand.y,
 		opt:            img.opt,
 	}
 
-	cc := img.p.SortColors()
-	if len(img.bpc) == 0 {
-		for _, col := range cc {
-			img.bpc = append(img.bpc, &col)
+	allSets, err := img.spriteColorSets()
+	if err != nil {
+		return s, fmt.Errorf("img.spriteColorSets failed: %w", err)
+	}
+	sets := allSets
+	if img.graphicsType == mixedSprites {
+		// the shared colors are only needed by the multicolor sprites.
+		s.Hires = img.hiresSprites(allSets)
+		sets = make([]map[C64Color]bool, len(allSets))
+		for i := range allSets {
+			sets[i] = allSets[i]
+			if s.Hires[i] {
+				sets[i] = map[C64Color]bool{}
+			}
 		}
 	}
+	cc := img.p.SortColors()
+	shared := map[byte]Color{}
+	var colors []C64Color
+	if len(cc) <= 4 {
+		if len(img.bpc) == 0 {
+			for _, col := range cc {
+				img.bpc = append(img.bpc, &col)
+			}
+		}
 
-	bp, err := img.newBitpairs(0, cc, false)
-	if err != nil {
-		return s, fmt.Errorf("img.newBitpairs failed: %v", err)
-	}
+		bp, err := img.newBitpairs(0, cc, false)
+		if err != nil {
+			return s, fmt.Errorf("img.newBitpairs failed: %v", err)
+		}
 
-	if img.opt.Verbose {
-		log.Printf("sprite colors: %v\n", cc)
-		log.Printf("bitpairs: %v\n", bp)
-	}
+		if img.opt.Verbose {
+			log.Printf("sprite colors: %v\n", cc)
+			log.Printf("bitpairs: %v\n", bp)
+		}
 
-	switch {
-	case len(img.bpc) > 3:
-		if img.bpc[3] != nil {
-			s.D026Color = byte(img.bpc[3].C64Color)
+		switch {
+		case len(img.bpc) > 3:
+			if img.bpc[3] != nil {
+				s.D026Color = byte(img.bpc[3].C64Color)
+			}
+			fallthrough
+		case len(img.bpc) > 2:
+			if img.bpc[2] != nil {
+				s.SpriteColor = byte(img.bpc[2].C64Color)
+			}
+			fallthrough
+		case len(img.bpc) > 1:
+			if img.bpc[1] != nil {
+				s.D025Color = byte(img.bpc[1].C64Color)
+			}
+			fallthrough
+		case len(img.bpc) > 0:
+			if img.bpc[0] != nil {
+				s.BackgroundColor = byte(img.bpc[0].C64Color)
+			}
 		}
-		fallthrough
-	case len(img.bpc) > 2:
-		if img.bpc[2] != nil {
-			s.SpriteColor = byte(img.bpc[2].C64Color)
+
+		def := C64Color(s.SpriteColor)
+		var sharedC64 []C64Color
+		for bitpair, col := range bp.bitpair2color {
+			if bitpair == 2 {
+				def = col.C64Color
+				continue
+			}
+			shared[bitpair] = col
+			sharedC64 = append(sharedC64, col.C64Color)
+		}
+		if colors, err = img.individualSpriteColors(sets, sharedC64, def); err != nil {
+			return s, fmt.Errorf("img.individualSpriteColors failed: %w", err)
+		}
+	} else {
+		d025, d026, err := img.sharedSpriteColors(sets)
+		if err != nil {
+			return s, fmt.Errorf("img.sharedSpriteColors failed: %w", err)
 		}
-		fallthrough
-	case len(img.bpc) > 1:
-		if img.bpc[1] != nil {
-			s.D025Color = byte(img.bpc[1].C64Color)
+		shared[0], shared[1], shared[3] = img.bg, img.p.FromC64NoErr(d025), img.p.FromC64NoErr(d026)
+		if colors, err = img.individualSpriteColors(sets, []C64Color{img.bg.C64Color, d025, d026}, 0); err != nil {
+			return s, fmt.Errorf("img.individualSpriteColors failed: %w", err)
 		}
-		fallthrough
-	case len(img.bpc) > 0:
-		if img.bpc[0] != nil {
-			s.BackgroundColor = byte(img.bpc[0].C64Color)
+		s.BackgroundColor, s.D025Color, s.D026Color = byte(img.bg.C64Color), byte(d025), byte(d026)
+		s.SpriteColor = byte(colors[0])
+		if img.opt.Verbose {
+			log.Printf("sprite colors: %v\n", cc)
+			log.Printf("shared colors: %v\n", shared)
 		}
 	}
+	if slices.Contains(s.Hires, true) {
+		bg, ok := shared[0]
+		if !ok {
+			bg = img.bg
+		}
+		shared[0] = bg
+		hiresSets := make([]map[C64Color]bool, len(allSets))
+		for i := range allSets {
+			hiresSets[i] = map[C64Color]bool{}
+			if s.Hires[i] {
+				hiresSets[i] = allSets[i]
+			}
+		}
+		hiresColors, err := img.individualSpriteColors(hiresSets, []C64Color{bg.C64Color}, colors[0])
+		if err != nil {
+			return s, fmt.Errorf("img.individualSpriteColors of singlecolor sprites failed: %w", err)
+		}
+		for i := range colors {
+			if s.Hires[i] {
+				colors[i] = hiresColors[i]
+			}
+		}
+		if img.opt.Verbose {
+			log.Printf("singlecolor sprites: %v\n", s.Hires)
+		}
+	}
+	if img.opt.Verbose {
+		log.Printf("individual sprite colors: %v\n", colors)
+	}
 
 	s.Columns = byte(img.width / SpriteWidth)
 	s.Rows = byte(img.height / SpriteHeight)
@@ -1259,15 +1850,32 @@ func (img *sourceImage) MultiColorSprites() (MultiColorSprites, error) {
 
 	for spriteY := 0; spriteY < int(s.Rows); spriteY++ {
 		for spriteX := 0; spriteX < int(s.Columns); spriteX++ {
+			i := spriteY*int(s.Columns) + spriteX
+			col := colors[i]
+			hires := len(s.Hires) > 0 && s.Hires[i]
+			bp := &bitpairs{bitpairs: []byte{0, 1, 2, 3}}
+			pixelWidth, individual, mcFlag := 2, byte(2), byte(0x80)
+			if hires {
+				bp = &bitpairs{bitpairs: []byte{0, 1}}
+				bp.add(0, shared[0])
+				pixelWidth, individual, mcFlag = 1, 1, 0
+			} else {
+				for bitpair, c := range shared {
+					bp.add(bitpair, c)
+				}
+			}
+			if c, err := img.p.FromC64(col); err == nil {
+				bp.add(individual, c)
+			}
 			for y := 0; y < SpriteHeight; y++ {
 				yOffset := y + spriteY*SpriteHeight
 				for x := 0; x < 3; x++ {
 					xOffset := x*8 + spriteX*SpriteWidth
 					bmpbyte := byte(0)
-					for pixel := 0; pixel < 8; pixel += 2 {
+					for pixel := 0; pixel < 8; pixel += pixelWidth {
 						col := img.At(xOffset+pixel, yOffset)
 						if bitpair, ok := bp.bitpair(col); ok {
-							bmpbyte |= bitpair << (6 - byte(pixel))
+							bmpbyte |= bitpair << (8 - byte(pixelWidth) - byte(pixel))
 						} else {
 							return s, fmt.Errorf("col %v not found in x %d, u %d.", col, x, y)
 						}
@@ -1275,9 +1883,21 @@ func (img *sourceImage) MultiColorSprites() (MultiColorSprites, error) {
 					s.Bitmap = append(s.Bitmap, bmpbyte)
 				}
 			}
-			s.Bitmap = append(s.Bitmap, 0)
+			// SpritePad convention: individual color in the low nibble, bit 7 set for multicolor.
+			s.Bitmap = append(s.Bitmap, mcFlag|byte(col))
+			s.Colors = append(s.Colors, byte(col))
 		}
 	}
+	if s.ObjectWidth, s.ObjectHeight, err = spriteObjects(img.opt); err != nil {
+		return s, fmt.Errorf("spriteObjects failed: %w", err)
+	}
+	if s.Bitmap, s.Colors, s.Index, err = dedupSprites(img.opt, s.Bitmap, s.Colors); err != nil {
+		return s, fmt.Errorf("dedupSprites failed: %w", err)
+	}
+	s.Bitmap, s.Colors = uniformSpriteColors(img.opt, s.Bitmap, s.Colors)
+	if err = checkSpriteMemory(img.opt, len(s.Bitmap), spritePositions(img.opt, s.Bitmap, s.Index)); err != nil {
+		return s, fmt.Errorf("checkSpriteMemory failed: %w", err)
+	}
 	if !img.opt.Quiet {
 		fmt.Printf("converted %d sprites\n", s.Columns*s.Rows)
 	}
@@ -0,0 +1,96 @@
+package png2prg
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCharsetSplits(t *testing.T) {
+	t.Parallel()
+	type tc struct {
+		in      string
+		want    []int
+		wantErr bool
+	}
+	testCases := []tc{
+		{"auto", nil, false},
+		{"8", []int{8}, false},
+		{"8,16", []int{8, 16}, false},
+		{" 1, 24", []int{1, 24}, false},
+		{"0", nil, true},
+		{"25", nil, true},
+		{"16,8", nil, true},
+		{"8,8", nil, true},
+		{"4,8,16", nil, true},
+		{"x", nil, true},
+		{"", nil, true},
+	}
+	for _, c := range testCases {
+		got, err := parseCharsetSplits(c.in)
+		if c.wantErr {
+			assert.NotNil(t, err, c.in)
+			continue
+		}
+		assert.Nil(t, err, c.in)
+		assert.Equal(t, c.want, got, c.in)
+	}
+}
+
+func TestRowColorsMultiColorCharset(t *testing.T) {
+	t.Parallel()
+	rgb := map[C64Color]color.RGBA{
+		0: {0x00, 0x00, 0x00, 0xff},
+		1: {0xff, 0xff, 0xff, 0xff},
+		2: {0xb5, 0x61, 0x48, 0xff},
+		3: {0x99, 0xe6, 0xf9, 0xff},
+		4: {0xc1, 0x61, 0xc9, 0xff},
+		5: {0x79, 0xd5, 0x70, 0xff},
+	}
+	// every char uses background 0 and charcolor 1, d022 and d023 are 2 and 3 in the top rows, 4 and 5 below.
+	const splitRow = 13
+	im := image.NewRGBA(image.Rect(0, 0, FullScreenWidth, FullScreenHeight))
+	for y := 0; y < FullScreenHeight; y++ {
+		d022, d023 := C64Color(2), C64Color(3)
+		if y/8 >= splitRow {
+			d022, d023 = 4, 5
+		}
+		pair := [4]C64Color{0, d022, d023, 1}
+		for x := 0; x < FullScreenWidth; x++ {
+			im.Set(x, y, rgb[pair[(x/2+y)%4]])
+		}
+	}
+	buf := &bytes.Buffer{}
+	require.Nil(t, png.Encode(buf, im))
+	in := buf.Bytes()
+
+	// 6 colors with 4 per char look like koala, -row-colors does not change the detection.
+	c, err := New(Options{Quiet: true, RowColors: true}, bytes.NewReader(in))
+	require.Nil(t, err)
+	_, err = c.WriteTo(&bytes.Buffer{})
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "-row-colors only supports mc and mixed charsets")
+	assert.Equal(t, multiColorBitmap, c.images[0].graphicsType)
+
+	c, err = New(Options{Quiet: true, RowColors: true, GraphicsMode: "mccharset", CurrentGraphicsType: multiColorCharset}, bytes.NewReader(in))
+	require.Nil(t, err)
+	buf.Reset()
+	_, err = c.WriteTo(buf)
+	require.Nil(t, err)
+	prg := buf.Bytes()
+	at := func(addr int) byte { return prg[addr-0x2000+2] }
+	assert.Equal(t, byte(1|8), at(CharsetColorRAMAddress))
+	for row := 0; row < FullScreenRows; row++ {
+		want := []byte{2, 3}
+		if row >= splitRow {
+			want = []byte{4, 5}
+		}
+		got := []byte{at(CharsetRowD022Address + row), at(CharsetRowD023Address + row)}
+		assert.ElementsMatch(t, want, got, "row %d", row)
+	}
+}
@@ -62,11 +62,12 @@ init_sprites:
 		lda #$ff
 		sta $d01c	// single/multicol
 
-		ldx #7
-		lda spr_spritecol
-	!:	sta $d027,x
-		dex
-		bpl !-
+		// SpritePad convention: individual color in the low nibble of the 64th byte.
+	.for (var i=0; i<8; i++) {
+		lda sprites+i*64+63
+		and #$0f
+		sta $d027+i
+	}
 		lda spr_d025col
 		sta $d025
 		lda spr_d026col
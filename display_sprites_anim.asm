@@ -0,0 +1,299 @@
+.const DEBUG = false
+.const MUSICDEBUG = false
+.const screenram      = $0400
+.const settings       = $1ff0
+.const sprites        = $2000
+.const spr_xpos_start = $40
+.const spr_ypos_start = $32
+
+.const zp_start       = $08
+.const zp_spr_lo      = zp_start + 0
+.const zp_spr_hi      = zp_start + 1
+.const zp_delays_lo   = zp_start + 2
+.const zp_delays_hi   = zp_start + 3
+.const zp_spr_xy_lo   = zp_start + 4
+.const zp_spr_xy_hi   = zp_start + 5
+
+.import source "lib.asm"
+
+.pc = $0801 "basic upstart"
+		.byte <basicend, >basicend, <year(), >year(), $9e
+		.text toIntString(start)
+		.text " PNG2PRG " + versionString()
+basicend:
+		.byte 0, 0, 0
+.pc = settings_start() "music_startsong"
+music_startsong:
+		.byte 0
+.pc = * "music_init"
+music_init:
+		jmp rrts
+.pc = * "music_play"
+music_play:
+		jmp rrts
+.pc = * "frame_delay"
+frame_delay:
+		.byte 0
+.pc = * "wait_seconds"
+wait_seconds:
+		.byte 0
+.pc = * "no_fade"
+no_fade:
+		.byte 0
+.pc = * "no_loop"
+no_loop:
+		.byte 0
+
+		.byte 0,0,0
+
+.pc = basicsys() "start"
+start:
+		sei
+		jsr $e544
+		lda #$35
+		sta $01
+		jsr vblank
+		lda #0
+		sta $d011
+		sta $d020
+		sta $d015
+
+		music_init_cia(music_startsong, music_init)
+
+		lda #<irq
+		sta $fffe
+		lda #>irq
+		sta $ffff
+
+		lda #$80
+	!:	cmp $d012
+		bne !-
+		lda #%00010001
+		sta $dc0e
+		cli
+
+init_sprites:
+		lda #0
+		sta $d010
+		sta $d017
+		sta $d01b
+		sta $d01d
+		lda spr_d025col
+		sta $d025
+		lda spr_d026col
+		sta $d026
+
+		// show the first 8 sprites of each frame.
+		ldx spr_per_frame
+		cpx #9
+		bcc !+
+		ldx #8
+	!:	lda #0
+	!:	sec
+		rol
+		dex
+		bne !-
+		sta spr_enable
+
+		lda #<$d000
+		sta zp_spr_xy_lo
+		lda #>$d000
+		sta zp_spr_xy_hi
+		lda #spr_xpos_start
+		sta spr_xpos
+		lda #spr_ypos_start
+		sta spr_ypos
+
+		ldy #0
+!loop:	ldx spr_columns
+!:		lda spr_xpos
+		sta (zp_spr_xy_lo),y
+		clc
+		adc #$18
+		sta spr_xpos
+		iny
+		lda spr_ypos
+		sta (zp_spr_xy_lo),y
+		iny
+		cpy #$10
+		beq !done+
+		dex
+		bne !-
+
+		lda spr_ypos
+		clc
+		adc #21
+		sta spr_ypos
+		lda #spr_xpos_start
+		sta spr_xpos
+
+		dec spr_rows
+		bne !loop-
+!done:
+		jsr anim_init
+
+		jsr vblank
+		:setBank(screenram)
+		lda #toD018(screenram, $1000)
+		sta $d018
+		lda #$c8
+		sta $d016
+		lda spr_bgcol
+		sta $d021
+		lda #$1b
+		sta $d011
+
+		// optional wait before anim start
+		ldy wait_seconds
+		beq !skip+
+!waitloop:
+		ldx #50
+	!:	jsr vblank
+		dex
+		bne !-
+		dey
+		bne !waitloop-
+!skip:
+		jsr vblank
+
+loop_anim:
+		.if (DEBUG) inc $d020
+		jsr anim_play
+		.if (DEBUG) dec $d020
+		lda no_loop
+		beq !++
+		bcc loop_anim
+!:		lda $dc01
+		cmp #$ef
+		bne !-
+		beq !done+
+
+!:		lda $dc01
+		cmp #$ef
+		bne loop_anim
+!done:
+		sei
+		lda #$37
+		sta $01
+		jsr vblank
+		lda #0
+		sta $d011
+		sta $d015
+		sta $d418
+		jsr $e544
+		jmp $fce2
+.pc = * "vblank"
+vblank:
+		:vblank()
+rrts:	rts
+// --------------------------------
+.pc = * "irq"
+irq:
+		pha
+		txa
+		pha
+		tya
+		pha
+		.if (MUSICDEBUG) dec $d020
+		jsr music_play
+		.if (MUSICDEBUG) inc $d020
+		lda $dc0d
+		pla
+		tay
+		pla
+		tax
+		pla
+		rti
+// ------------------------------
+// anim_play shows the current frame and waits for its frame delay.
+// Returns with carry set after the last frame.
+.pc = * "anim_play"
+anim_play:
+		ldx #0
+!loop:
+		txa
+		clc
+		adc spr_pointer
+		sta screenram+$3f8,x
+		// the 64th byte of the sprite at pointer*64 holds its color and multicolor bit.
+		tay
+		lsr
+		lsr
+		sta zp_spr_hi
+		tya
+		and #3
+		lsr
+		ror
+		ror
+		ora #$3f
+		sta zp_spr_lo
+		ldy #0
+		lda (zp_spr_lo),y
+		asl
+		ror spr_d01c
+		lsr
+		and #$0f
+		sta $d027,x
+		inx
+		cpx #8
+		bne !loop-
+		lda spr_d01c
+		sta $d01c
+		lda spr_enable
+		sta $d015
+
+		ldy spr_frame
+		lda (zp_delays_lo),y
+		tax
+		beq !++
+	!:	jsr vblank
+		dex
+		bne !-
+	!:
+		lda spr_pointer
+		clc
+		adc spr_per_frame
+		sta spr_pointer
+		inc spr_frame
+		lda spr_frame
+		cmp spr_num_frames
+		bne !skip+
+
+.pc = * "anim_init"
+anim_init:
+		lda #toSpritePtr(sprites)
+		sta spr_pointer
+		lda #0
+		sta spr_frame
+		lda spr_delays_lo
+		sta zp_delays_lo
+		lda spr_delays_hi
+		sta zp_delays_hi
+		sec
+		rts
+!skip:	clc
+		rts
+// ------------------------------
+.pc = * "variables"
+spr_xpos:		.byte 0
+spr_ypos:		.byte 0
+spr_enable:		.byte 0
+spr_d01c:		.byte 0
+spr_pointer:	.byte 0
+spr_frame:		.byte 0
+// ------------------------------
+.pc = settings "sprite_settings" virtual
+spr_columns:	.byte 0
+spr_rows:		.byte 0
+spr_bgcol:		.byte 0
+spr_d025col:	.byte 0
+spr_d026col:	.byte 0
+spr_per_frame:	.byte 0
+spr_num_frames:	.byte 0
+spr_delays_lo:	.byte 0
+spr_delays_hi:	.byte 0
+// ------------------------------
+.pc = sprites "sprites" virtual
+anim_sprites:
+		.fill 64, 0
+// followed by the frame delay table at spr_delays_lo/hi
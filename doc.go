@@ -64,8 +64,11 @@ func PrintHelp() {
 	fmt.Println("    sccharset:    singlecolor charset (max 2 colors per char (fixed bgcol))")
 	fmt.Println("    petscii:      singlecolor rom charset (max 2 colors per char (fixed bgcol))")
 	fmt.Println("    ecm:          singlecolor charset (max 2 colors per char (4 fixed bgcolors), max 64 chars)")
+	fmt.Println("    ecmpetscii:   ecm using the first 64 rom chars (max 2 colors per char (4 fixed bgcolors))")
 	fmt.Println("    mcsprites:    multicolor sprites (max 4 colors)")
 	fmt.Println("    scsprites:    singlecolor sprites (max 2 colors)")
+	fmt.Println("    mixedsprites: multicolor and singlecolor sprites (max 4 or 2 colors per sprite)")
+	fmt.Println("    layeredsprites: hires sprites on top of multicolor sprites (max 5 colors per sprite)")
 	fmt.Println("    mcibitmap:    320x200 multicolor interlace bitmap (max 4 colors per char/frame)")
 	fmt.Println()
 	fmt.Println("Png2prg is mostly able to autodetect the correct graphics mode, but you can")
@@ -82,6 +85,27 @@ func PrintHelp() {
 	fmt.Println("    D021:   $4710         (multicolor only, low-nibble)")
 	fmt.Println("    D020:   $4710         (multicolor only, high-nibble)")
 	fmt.Println()
+	fmt.Println("### Sprite Overlay (-sprite-overlay)")
+	fmt.Println()
+	fmt.Println("Images that exceed the colors per char only in a few areas can be converted")
+	fmt.Println("with a layer of singlecolor sprites on top of the bitmap. The least used")
+	fmt.Println("colors of each char that has too many colors are moved to the sprites, for")
+	fmt.Println("koala also hires details. Each sprite has 1 color, stored in the 64th byte.")
+	fmt.Println("Png2prg warns about the lines that show more than 8 sprites.")
+	fmt.Println("The positions are stored in hardware sprite coordinates, see the overlay")
+	fmt.Println("symbols. Only koala (default) and hires are supported, without displayer.")
+	fmt.Println()
+	fmt.Println("The sprites end at $1000, in vic bank 0 with the bitmap, which limits the")
+	fmt.Println("overlay to 32 sprites. Sprite n uses pointer overlaypointer+n.")
+	fmt.Println()
+	fmt.Println("    ./png2prg -sprite-overlay -sym image.png")
+	fmt.Println()
+	fmt.Println("    Sprites: $1000-64*n, 64 bytes per sprite")
+	fmt.Println("    X:       $4740 (koala) or $4340 (hires), 1 byte per sprite,")
+	fmt.Println("             followed by the high bits of x")
+	fmt.Println("    Y:       1 byte per sprite")
+	fmt.Println("    Colors:  1 byte per sprite")
+	fmt.Println()
 	fmt.Println("## Multicolor Interlace Bitmap")
 	fmt.Println()
 	fmt.Println("You can supply one 320x200 multicolor image with max 4 colors per 8x8 pixel")
@@ -117,6 +141,34 @@ func PrintHelp() {
 	fmt.Println("    Screen2: $e000 - $e3e7")
 	fmt.Println("    D800:    $e400 - $e7e7")
 	fmt.Println()
+	fmt.Println("### Blended Colors (-blended)")
+	fmt.Println()
+	fmt.Println("With -blended, 1 image containing blended colors is split into 2 interlace")
+	fmt.Println("frames. Each blended color is matched to the average of 2 c64 colors.")
+	fmt.Println("If several color pairs result in (almost) the same blended color, the pair")
+	fmt.Println("with the least luminance difference is used, to minimize flicker.")
+	fmt.Println("Per char, the colors of each pair are divided over both frames to stay")
+	fmt.Println("within the colors per char of each frame.")
+	fmt.Println("Both frames are displayed at the same position, -blended implies -d016 0.")
+	fmt.Println()
+	fmt.Println("    ./png2prg -blended blended.png")
+	fmt.Println()
+	fmt.Println("## Hires Interlace Bitmap")
+	fmt.Println()
+	fmt.Println("Use -mode hires -interlace to convert 2 hires frames, or 1 image with blended")
+	fmt.Println("colors, where each blended color is the average of 2 c64 colors.")
+	fmt.Println("Where possible, the screenram colors of both frames are aligned.")
+	fmt.Println("The displayer does not support hires interlace (yet).")
+	fmt.Println()
+	fmt.Println("    ./png2prg -m hires -i frame0.png frame1.png")
+	fmt.Println("    ./png2prg -m hires -i blended.png")
+	fmt.Println()
+	fmt.Println("    Screen1: $9c00 - $9fe7")
+	fmt.Println("    D020:    $9fe8")
+	fmt.Println("    Bitmap1: $a000 - $bf3f")
+	fmt.Println("    Bitmap2: $c000 - $df3f")
+	fmt.Println("    Screen2: $e000 - $e3e7")
+	fmt.Println()
 	fmt.Println("## Singlecolor, PETSCII or ECM Charset (individual d800 colors)")
 	fmt.Println()
 	fmt.Println("By default charsets are packed, they only contain unique characters.")
@@ -124,7 +176,18 @@ func PrintHelp() {
 	fmt.Println()
 	fmt.Println("With ECM -bitpair-colors can be used to force d021-d024 colors.")
 	fmt.Println()
-	fmt.Println("NB: individual d800 colors are not supported with -no-pack.")
+	fmt.Println("ECM PETSCII images only use the first 64 chars of the uppercase or lowercase")
+	fmt.Println("rom charset, so no charset is stored. Each char picks one of the 4 background")
+	fmt.Println("colors d021-d024. Png2prg detects ecm petscii automatically, or force it with")
+	fmt.Println("-m ecmpetscii. The lowercase and romcharset symbols tell which rom charset is")
+	fmt.Println("used, the d018 symbol selects the screenram and the builtin rom charset in vic")
+	fmt.Println("bank 0.")
+	fmt.Println("Combined with -max-chars 64, chars are replaced by the most similar rom chars.")
+	fmt.Println("With -display the 64 rom chars are included, as the ecm displayer is used.")
+	fmt.Println()
+	fmt.Println("With -no-pack each char keeps its individual d800 color, also for mc and")
+	fmt.Println("mixed charsets. In mc charsets d021, d022 and d023 are shared and bitpair 11")
+	fmt.Println("uses the d800 color (0-7) of each char.")
 	fmt.Println()
 	fmt.Println("    ./png2prg -m sccharset testdata/hirescharset/ohno_logo.png")
 	fmt.Println("    ./png2prg -m petscii testdata/petscii/hein_hibiscus.png")
@@ -132,14 +195,79 @@ func PrintHelp() {
 	fmt.Println("    ./png2prg -m ecm testdata/ecm/shampoo.png")
 	fmt.Println("    ./png2prg -m ecm -bpc 2,7,14,0 testdata/ecm/orion.png")
 	fmt.Println()
-	fmt.Println("    Charset:   $2000-$27ff (omitted for petscii)")
+	fmt.Println("    Charset:   $2000-$27ff (omitted for petscii and ecmpetscii)")
 	fmt.Println("    Screen:    $2800-$2be7")
 	fmt.Println("    D800:      $2c00-$2fe7")
 	fmt.Println("    D020:      $2fe8")
 	fmt.Println("    D021:      $2fe9")
-	fmt.Println("    D022:      $2fea (ecm only)")
-	fmt.Println("    D023:      $2feb (ecm only)")
-	fmt.Println("    D024:      $2fec (ecm only)")
+	fmt.Println("    D022:      $2fea (ecm and ecmpetscii only)")
+	fmt.Println("    D023:      $2feb (ecm and ecmpetscii only)")
+	fmt.Println("    D024:      $2fec (ecm and ecmpetscii only)")
+	fmt.Println()
+	fmt.Println("### Petsciify (-petsciify)")
+	fmt.Println()
+	fmt.Println("Images that do not consist of rom chars can be converted to petscii with")
+	fmt.Println("-petsciify. For each char the best matching rom char and d800 color is")
+	fmt.Println("picked, the most used color is the background unless forced with -bpc.")
+	fmt.Println("All rom charsets are tried, the lowercase and romcharset symbols tell which one")
+	fmt.Println("is used.")
+	fmt.Println("Images with more than 16 colors are first reduced to the c64 palette.")
+	fmt.Println()
+	fmt.Println("By default chars are compared by pixel error. With -petsciify-metric structure")
+	fmt.Println("the average colors of 2x2 pixel blocks are compared instead, which favours")
+	fmt.Println("chars with a similar density and shape over exact pixel positions.")
+	fmt.Println("Png2prg reports the number of exactly matching chars and differing pixels,")
+	fmt.Println("use -verbose to list the worst chars and -petsciify-preview to write a .png.")
+	fmt.Println()
+	fmt.Println("    ./png2prg -petsciify -petsciify-preview preview.png sketch.png")
+	fmt.Println("    ./png2prg -petsciify -petsciify-metric structure -bpc 0 sketch.png")
+	fmt.Println()
+	fmt.Println("### Alternative ROM Charsets (-rom-charsets)")
+	fmt.Println()
+	fmt.Println("Petscii detection, ecm petscii and -petsciify try the uppercase and lowercase")
+	fmt.Println("rom charsets by default. Use -rom-charsets to replace them by a comma separated")
+	fmt.Println("list of builtin names (uppercase, lowercase) and charset files (.bin, .prg")
+	fmt.Println("or image), eg international c64 roms, the c128 rom or a system font that a game")
+	fmt.Println("keeps in memory. They are tried in order and no charset is stored.")
+	fmt.Println("A charset file is named after its filename without extension. The romcharset")
+	fmt.Println("symbol is the index of the used rom charset in -rom-charsets, by default 0 for")
+	fmt.Println("uppercase and 1 for lowercase.")
+	fmt.Println("The displayers, -split-screen and petscii documents only support the builtin")
+	fmt.Println("rom charsets, except ecm petscii with -display, as it includes the 64 chars.")
+	fmt.Println()
+	fmt.Println("    ./png2prg -sym -rom-charsets swedish.bin,uppercase,lowercase image.png")
+	fmt.Println("    ./png2prg -m petscii -rom-charsets gamefont.prg image.png")
+	fmt.Println()
+	fmt.Println("### PETSCII Editor Documents (Petmate and Marq's PETSCII)")
+	fmt.Println()
+	fmt.Println("Instead of .png screenshots, png2prg also reads documents of the PETSCII")
+	fmt.Println("editors: Petmate .petmate, the .c source exported by Marq's PETSCII and .pet.")
+	fmt.Println("Documents with multiple screens or frames are converted to an animation.")
+	fmt.Println("Only 40x25 screens using the upper or lower rom charset are supported.")
+	fmt.Println()
+	fmt.Println("Use -petscii-export petmate, marq or pet to write a document instead of .prg.")
+	fmt.Println("This works for petscii images, -petsciify and petscii animations.")
+	fmt.Println("The input document is never overwritten: exporting b.petmate to petmate")
+	fmt.Println("writes b_out.petmate and an -o equal to an input file is refused.")
+	fmt.Println("A .pet frame consists of width, height, border color, background color,")
+	fmt.Println("charset (0 = upper, 1 = lower), 1000 screencodes and 1000 colors.")
+	fmt.Println()
+	fmt.Println("Two more -petscii-export formats do not need a displayer:")
+	fmt.Println()
+	fmt.Println("    seq:   .seq stream of petscii codes, with color and reverse on/off codes,")
+	fmt.Println("           eg for BBS art. Border and background colors are not included.")
+	fmt.Println("    basic: tokenized BASIC .prg that sets the colors and prints the picture.")
+	fmt.Println()
+	fmt.Println("As printing the bottom right char would scroll the screen, the .seq prints")
+	fmt.Println("the last 2 chars in reverse order and inserts the last char in place.")
+	fmt.Println("A quote in the last 2 chars of a .seq is replaced by a space.")
+	fmt.Println("The BASIC program pokes the last 2 chars instead.")
+	fmt.Println()
+	fmt.Println("    ./png2prg -d drawing.petmate")
+	fmt.Println("    ./png2prg -d frames.c")
+	fmt.Println("    ./png2prg -petscii-export petmate testdata/petscii/hein_hibiscus.png")
+	fmt.Println("    ./png2prg -petscii-export seq testdata/petscii/hein_hibiscus.png")
+	fmt.Println("    ./png2prg -petscii-export basic testdata/petscii/hein_hibiscus.png")
 	fmt.Println()
 	fmt.Println("## Mixed Multi/Singlecolor Charset (individual d800 colors)")
 	fmt.Println()
@@ -167,6 +295,138 @@ func PrintHelp() {
 	fmt.Println("    D022:      $2fea")
 	fmt.Println("    D023:      $2feb")
 	fmt.Println()
+	fmt.Println("### Row Colors (-row-colors)")
+	fmt.Println()
+	fmt.Println("For mc and mixed charsets -row-colors solves the shared d022 and d023 colors")
+	fmt.Println("per char row, the background and mc charcolor remain fixed for all rows.")
+	fmt.Println("This allows different shared colors in different bands of the screen.")
+	fmt.Println("Images with different colors per row are detected as bitmaps, so force the")
+	fmt.Println("charset mode with -mode mccharset or mixedcharset.")
+	fmt.Println("The 25 d022 and d023 colors are stored in row tables, to be set by your")
+	fmt.Println("own raster splits. The displayer does not support this (yet).")
+	fmt.Println()
+	fmt.Println("    ./png2prg -m mixedcharset -row-colors -sym image.png")
+	fmt.Println()
+	fmt.Println("    D022 rows: $3000-$3018")
+	fmt.Println("    D023 rows: $3020-$3038")
+	fmt.Println()
+	fmt.Println("## Charset Splits (-charset-splits)")
+	fmt.Println()
+	fmt.Println("If a sc, mc or mixed charset image packs to more than 256 unique chars,")
+	fmt.Println("-charset-splits can divide the screen in max 3 horizontal bands of char rows,")
+	fmt.Println("with a packed charset each. Use -charset-splits auto to start a new band")
+	fmt.Println("when the current charset is full, or specify the char rows where the bands")
+	fmt.Println("start, eg -charset-splits 8,16. Switching charsets with $d018 at the band")
+	fmt.Println("boundaries is left to your own code, the displayer does not support this.")
+	fmt.Println()
+	fmt.Println("    ./png2prg -m sccharset -charset-splits auto -sym image.png")
+	fmt.Println()
+	fmt.Println("    Charset0:  $2000-$27ff")
+	fmt.Println("    Charset1:  $3000-$37ff (symbols charset1 and charset1row)")
+	fmt.Println("    Charset2:  $3800-$3fff (symbols charset2 and charset2row)")
+	fmt.Println()
+	fmt.Println("## Font (-font)")
+	fmt.Println()
+	fmt.Println("Convert a font sheet, a grid of glyphs, to an unpacked charset in PETSCII")
+	fmt.Println("screencode order. Specify the size of a glyph in chars: 1x1, 1x2, 2x1 or 2x2.")
+	fmt.Println("The chars of a multi-char glyph are stored at screencode + part * offset,")
+	fmt.Println("where the offset is 256 / chars per glyph and part counts the chars of the")
+	fmt.Println("glyph from left to right, top to bottom. A 2x2 glyph uses chars c, c+64,")
+	fmt.Println("c+128 and c+192, so max 64 glyphs fit.")
+	fmt.Println("By default the glyphs are in screencode order (@ABC...). Use -font-map with")
+	fmt.Println("the ascii chars of the glyphs in the sheet if they are in a different order.")
+	fmt.Println("A 128 byte table to map ascii to screencodes is stored after the charset,")
+	fmt.Println("unmapped chars are mapped to the space. Use -mode mccharset for multicolor.")
+	fmt.Println()
+	fmt.Println("    ./png2prg -font 2x2 -font-map \" ABCDEFGHIJKLMNOPQRSTUVWXYZ!.,\" bigfont.png")
+	fmt.Println()
+	fmt.Println("    Charset:   $2000-$27ff")
+	fmt.Println("    Table:     $2800-$287f")
+	fmt.Println()
+	fmt.Println("## Char Order (-char-order)")
+	fmt.Println()
+	fmt.Println("By default, packed chars are stored in order of first appearance.")
+	fmt.Println("Use -char-order frequency to store the most used chars first, or")
+	fmt.Println("-char-order similarity to store similar chars next to each other, which")
+	fmt.Println("minimizes byte deltas and may crunch better.")
+	fmt.Println("If your code references specific chars, use -char-order stable together with")
+	fmt.Println("-charset and the output of the previous conversion. Chars that are still used")
+	fmt.Println("keep their index, new chars are stored in the slots of chars no longer used.")
+	fmt.Println()
+	fmt.Println("    ./png2prg -m sccharset -char-order frequency level.png")
+	fmt.Println("    ./png2prg -m sccharset -char-order stable -charset level.prg level.png")
+	fmt.Println()
+	fmt.Println("## Max Chars (-max-chars)")
+	fmt.Println()
+	fmt.Println("If a sc, mc, mixed or ecm charset image packs to too many chars, -max-chars n")
+	fmt.Println("merges the most similar chars until the charset fits in n chars.")
+	fmt.Println("The similarity is the number of changed pixels, counted in bitpairs for")
+	fmt.Println("multicolor chars, times the number of times the char is used.")
+	fmt.Println("Colors are not changed, only the pixels of the merged chars.")
+	fmt.Println("Use -verbose to list the altered chars and -max-chars-diff to write a png")
+	fmt.Println("of the image with the altered pixels marked in red.")
+	fmt.Println()
+	fmt.Println("    ./png2prg -m mccharset -max-chars 192 -max-chars-diff diff.png image.png")
+	fmt.Println()
+	fmt.Println("## Charset File (-charset)")
+	fmt.Println()
+	fmt.Println("To reuse and extend a charset that is already in your game, convert sc, mc,")
+	fmt.Println("mixed or ecm charset images with -charset file. The file can be a raw .bin,")
+	fmt.Println("a .prg with load address or, for sc and ecm charsets, an image of 8x8 chars")
+	fmt.Println("(the most used color is background). Images can not be used for mc and mixed")
+	fmt.Println("charsets. Chars found in the charset are reused, new chars are stored in")
+	fmt.Println("free slots. By default all chars of the file are kept, so only the slots")
+	fmt.Println("after the end of the file are free. Use -charset-reserve to keep only")
+	fmt.Println("specific chars, eg 0-63 for the game font, all other slots are free.")
+	fmt.Println("If the new chars do not fit, the conversion fails and reports how many")
+	fmt.Println("chars were reused and how many new chars did not fit in the free slots.")
+	fmt.Println()
+	fmt.Println("    ./png2prg -m mccharset -charset game.bin -charset-reserve 0-63 level2.png")
+	fmt.Println()
+	fmt.Println("## Shared Charset (-shared-charset)")
+	fmt.Println()
+	fmt.Println("For games with many screens, like levels or menus, -shared-charset converts")
+	fmt.Println("multiple sc, mc or mixed charset images to independent screens, sharing one")
+	fmt.Println("packed charset. Unlike animations, the screens are not diffed, each screen")
+	fmt.Println("is stored in full with its own colorram and colors.")
+	fmt.Println("To pack mc or mixed charsets efficiently, force the same -bitpair-colors.")
+	fmt.Println("Use -symbols for the screenN, colorramN, colorsN and d02xcolorN symbols.")
+	fmt.Println("The screens share the vic bank of the charset, so max 6 screens are supported.")
+	fmt.Println("The colorram and colors are not read by the vic and are stored after $4000.")
+	fmt.Println()
+	fmt.Println("    ./png2prg -m mccharset -shared-charset -sym level1.png level2.png menu.png")
+	fmt.Println()
+	fmt.Println("    Charset:   $2000-$27ff")
+	fmt.Println("    Screen0:   $2800-$2be7")
+	fmt.Println("    Screen1:   $2c00-$2fe7 (every next screen is located $400 bytes further)")
+	fmt.Println("    D800color: $4000-$43e7")
+	fmt.Println("    Colors:    $43e8-$43eb (border, background, d022, d023)")
+	fmt.Println("    D800color: $4400-$47e7 (colorram and colors of screen1, and so on)")
+	fmt.Println()
+	fmt.Println("## Split Screen (-split-screen)")
+	fmt.Println()
+	fmt.Println("A 320x200 image can be converted as a bitmap region and a charset region,")
+	fmt.Println("split at a char row. Specify the mode of the top region, the char row where")
+	fmt.Println("the bottom region starts and the mode of the bottom region.")
+	fmt.Println("One region must be koala or hires, the other sccharset, mccharset,")
+	fmt.Println("mixedcharset or petscii. Both regions share the colorram.")
+	fmt.Println("All data is located in vic bank 2, use -symbols for the $dd00 bank bits, the")
+	fmt.Println("$d011, $d016 and $d018 values of each region and the raster line of the split.")
+	fmt.Println("The displayer does not support this (yet).")
+	fmt.Println()
+	fmt.Println("    ./png2prg -split-screen koala,18,petscii -sym image.png")
+	fmt.Println()
+	fmt.Println("    Charset:   $8000-$87ff (omitted for petscii)")
+	fmt.Println("    Screen:    $8800-$8be7 (charset region)")
+	fmt.Println("    Screen:    $8c00-$8fe7 (bitmap region)")
+	fmt.Println("    D800:      $9000-$93e7")
+	fmt.Println("    D020:      $93e8")
+	fmt.Println("    D021:      $93e9 (bitmap region)")
+	fmt.Println("    D021:      $93ea (charset region)")
+	fmt.Println("    D022:      $93eb")
+	fmt.Println("    D023:      $93ec")
+	fmt.Println("    Bitmap:    $a000-$bf3f")
+	fmt.Println()
 	fmt.Println("## Single or Multicolor Sprites")
 	fmt.Println()
 	fmt.Println("If the source image size is a multiple of a 24x21 pixel sprite,")
@@ -178,9 +438,100 @@ func PrintHelp() {
 	fmt.Println("    ./png2prg -m scsprites image.png")
 	fmt.Println("    ./png2prg -m mcsprites image.png")
 	fmt.Println()
+	fmt.Println("Each sprite can use its own individual color, while the background and the")
+	fmt.Println("multicolors d025 and d026 are shared by all sprites. Png2prg finds the shared")
+	fmt.Println("colors, or force them with -bitpair-colors bg,d025,spritecolor,d026.")
+	fmt.Println("If the sprites use different individual colors, like SpritePad, the 64th byte")
+	fmt.Println("of each sprite contains the individual color in the low nibble, bit 7 is set")
+	fmt.Println("for multicolor sprites. The color table follows the sprites, 1 byte per")
+	fmt.Println("sprite, see the spritecolors symbol. If all sprites use the same color, the")
+	fmt.Println("64th byte stays 0 and no color table is stored, like in earlier versions.")
+	fmt.Println("The displayer shows each sprite in the individual color of its 64th byte.")
+	fmt.Println()
+	fmt.Println("Sheets that combine hires sprites (max 2 colors) with multicolor sprites are")
+	fmt.Println("converted to mixedsprites, deciding per sprite by its pixel widths and colors.")
+	fmt.Println("The singlecolor sprites have bit 7 of the 64th byte cleared, they use the")
+	fmt.Println("shared background color. Mixed sprites have no displayer support.")
+	fmt.Println()
+	fmt.Println("    ./png2prg -m mixedsprites image.png")
+	fmt.Println()
 	fmt.Println("    Sprite 1: $2000-$203f")
 	fmt.Println("    Sprite 2: $2040-$207f")
 	fmt.Println("    ...")
+	fmt.Println("    Colors:   1 byte per sprite (only for individual colors, not with -display)")
+	fmt.Println()
+	fmt.Println("### Sprite Sheets")
+	fmt.Println()
+	fmt.Println("Sprite sheets with grid lines or borders can be converted with -sprite-spacing")
+	fmt.Println("(pixels between the sprites) and -sprite-margin (pixels at the top and left).")
+	fmt.Println("Use -sprite-rect x,y,width,height to only convert a part of the sheet and")
+	fmt.Println("-sprite-column-major to read the sprites top to bottom, then left to right.")
+	fmt.Println()
+	fmt.Println("Objects larger than 1 sprite are grouped with -sprite-objects wxh.")
+	fmt.Println("The sprites of each object are stored consecutively, left to right and top to")
+	fmt.Println("bottom, so object n starts at sprite n*w*h.")
+	fmt.Println("The numobjects, objectwidth and objectheight symbols describe the objects.")
+	fmt.Println("The displayer shows the sprites in this order.")
+	fmt.Println()
+	fmt.Println("    ./png2prg -sprite-spacing 1 -sprite-margin 1 sheet.png")
+	fmt.Println("    ./png2prg -sps 1 -sprite-objects 2x2 -sprite-rect 0,0,98,86 sheet.png")
+	fmt.Println()
+	fmt.Println("### Sprite Deduplication")
+	fmt.Println()
+	fmt.Println("With -sprite-dedup identical sprites are stored once, -sprite-mirror also")
+	fmt.Println("stores horizontally mirrored sprites once and -sprite-trim skips empty")
+	fmt.Println("sprites. The sprite index table is stored after the color table, mapping each")
+	fmt.Println("sprite of the sheet in objects order to a stored sprite, see the spriteindex")
+	fmt.Println("symbol. Bit 7 of the index is set for mirrored sprites, $ff marks empty")
+	fmt.Println("sprites. These options are not supported for animations and have no displayer")
+	fmt.Println("support.")
+	fmt.Println()
+	fmt.Println("    ./png2prg -sprite-mirror -sprite-trim -sym sheet.png")
+	fmt.Println()
+	fmt.Println("### Sprite Address")
+	fmt.Println()
+	fmt.Println("Sprites are loaded at $2000 by default, use -sprite-address to load them")
+	fmt.Println("elsewhere, 64 byte aligned, eg $3000 or 0x8000.")
+	fmt.Println("With -sprite-address or -sprite-names the sprites must fit in the 16k vic bank")
+	fmt.Println("of the address and can not use $1000-$1fff or $9000-$9fff, where the vic sees")
+	fmt.Println("the rom charset. The tables after the sprites are not checked.")
+	fmt.Println("With -sprite-address or -sprite-names the symbols include the vicbank and the")
+	fmt.Println("sprite pointer of each sprite, eg sprite_0 = $80 at $2000. With a sprite")
+	fmt.Println("index table, there is a pointer for each position in the table. A mirrored")
+	fmt.Println("position points at the unmirrored sprite and adds sprite_<name>_mirrored = 1.")
+	fmt.Println("Name the pointers with -sprite-names, a .csv or .yaml list of names in the")
+	fmt.Println("order of the sprites, eg walk0 results in sprite_walk0.")
+	fmt.Println("There is no displayer support for -sprite-address.")
+	fmt.Println()
+	fmt.Println("    ./png2prg -sprite-address $c000 -sprite-names names.csv -sym sheet.png")
+	fmt.Println()
+	fmt.Println("### Layered Sprites")
+	fmt.Println()
+	fmt.Println("With -mode layeredsprites each sprite is split in a multicolor sprite with a")
+	fmt.Println("hires sprite on top, for outlines and details. All pixels in the color of")
+	fmt.Println("the hires sprite are drawn by the hires sprite, the multicolor sprite fills in")
+	fmt.Println("the rest. Each hires pixel next to a different color must use the same color")
+	fmt.Println("per sprite. The multicolor sprites are followed by the hires sprites in the")
+	fmt.Println("same order, see the hiresbitmap and numsprites symbols: sprite n is paired")
+	fmt.Println("with sprite n+numsprites. The color table contains both layers.")
+	fmt.Println("Layered sprites have no displayer support.")
+	fmt.Println()
+	fmt.Println("    ./png2prg -m layeredsprites -sym sprites.png")
+	fmt.Println()
+	fmt.Println("### Expanded Sprites")
+	fmt.Println()
+	fmt.Println("Sprites drawn x and/or y expanded, with doubled pixels in 48x21, 24x42 or")
+	fmt.Println("48x42 pixel cells, are reduced to native 24x21 sprites. The expandx and")
+	fmt.Println("expandy symbols tell which of $d01d and $d017 to set.")
+	fmt.Println("Use -sprite-expand x, y or xy to set the expansion, which is also required for")
+	fmt.Println("sprite sheets, or -sprite-expand auto to detect it. Y expansion is detected if")
+	fmt.Println("all pairs of rows are identical, x expansion by pixels that are 4 wide.")
+	fmt.Println("X expanded singlecolor sprites look like multicolor sprites, combined with")
+	fmt.Println("-mode scsprites they are detected by pixels that are 2 wide.")
+	fmt.Println()
+	fmt.Println("    ./png2prg -sprite-expand x sprites.png")
+	fmt.Println("    ./png2prg -sprite-expand auto -m scsprites sprites.png")
+	fmt.Println("    ./png2prg -sprite-expand xy -sprite-spacing 1 sheet.png")
 	fmt.Println()
 	fmt.Println("## Bitpair Colors")
 	fmt.Println()
@@ -207,7 +558,18 @@ func PrintHelp() {
 	fmt.Println()
 	fmt.Println("## Sprite Animation")
 	fmt.Println()
-	fmt.Println("Each frame will be concatenated in the output .prg.")
+	fmt.Println("Each frame will be concatenated in the output .prg, followed by the frame")
+	fmt.Println("delay table: 1 byte per frame, from -frame-delay or the animation csv.")
+	fmt.Println("The numframes and framedelays symbols describe the table, the sprites of")
+	fmt.Println("frame n start at bitmap + n * columns * rows * 64.")
+	fmt.Println()
+	fmt.Println("With -d the displayer plays the animation by cycling the sprite pointers of")
+	fmt.Println("the first 8 sprites of each frame, with the delays of the table, -wait-seconds")
+	fmt.Println("and -no-loop. The color and multicolor flag of each sprite are read from its")
+	fmt.Println("64th byte, so mixed sprites are supported. The sprites are stored at $2000,")
+	fmt.Println("in vic bank 0, which limits the animation to 128 sprites.")
+	fmt.Println()
+	fmt.Println("    ./png2prg -d -frame-delay 4 walk0.png walk1.png walk2.png")
 	fmt.Println()
 	fmt.Println("## Bitmap Animation (only koala and hires)")
 	fmt.Println()
@@ -463,6 +825,35 @@ func PrintHelp() {
 	fmt.Println("   Trident (thanks!).")
 	fmt.Println(" - Experimental: Add secondary+tertiary preferred bitpair colors with -bpc2")
 	fmt.Println("   and -bpc3 (thanks Fungus).")
+	fmt.Println(" - Feature: Add -row-colors to solve d022/d023 per char row for mc and mixed")
+	fmt.Println("   charsets.")
+	fmt.Println(" - Feature: Add -charset-splits to use up to 3 charsets in horizontal bands.")
+	fmt.Println(" - Feature: Add -split-screen to convert a bitmap and a charset region.")
+	fmt.Println(" - Feature: Add hires interlace with -mode hires -interlace.")
+	fmt.Println(" - Feature: Add -blended to split blended colors into 2 interlace frames.")
+	fmt.Println(" - Feature: Add -charset and -charset-reserve to convert using an existing charset.")
+	fmt.Println(" - Feature: Add -shared-charset to convert multiple screens with 1 shared charset.")
+	fmt.Println(" - Feature: Add -max-chars to merge similar chars and fit a char budget.")
+	fmt.Println(" - Feature: Add -char-order to order packed chars by frequency, similarity or stable.")
+	fmt.Println(" - Feature: Add -font to convert font sheets to a charset in screencode order.")
+	fmt.Println(" - Feature: Support individual d800 colors with -no-pack for sc, mc and mixed charsets.")
+	fmt.Println(" - Feature: Add -mode ecmpetscii to convert to ecm using the first 64 rom chars.")
+	fmt.Println(" - Feature: Add -petsciify for lossy petscii conversion of any image.")
+	fmt.Println(" - Feature: Read Petmate and Marq's PETSCII documents, write them with -petscii-export.")
+	fmt.Println(" - Feature: Add -petscii-export seq and basic to print petscii without displayer.")
+	fmt.Println(" - Feature: Add -rom-charsets to detect petscii using alternative rom charsets.")
+	fmt.Println(" - Feature: Add -sprite-spacing, -sprite-margin, -sprite-rect,")
+	fmt.Println("   -sprite-column-major and -sprite-objects for sprite sheet layouts.")
+	fmt.Println(" - Feature: Individual color per sprite. If the sprites use different colors,")
+	fmt.Println("   the 64th byte of each sprite holds its color instead of 0, followed by a")
+	fmt.Println("   color table after the sprites. The sprite displayers read the 64th byte.")
+	fmt.Println(" - Feature: Add -mode mixedsprites for sheets of singlecolor and multicolor sprites.")
+	fmt.Println(" - Feature: Add -sprite-expand for x/y expanded sprites, auto detects them.")
+	fmt.Println(" - Feature: Add -mode layeredsprites for hires sprites on top of multicolor sprites.")
+	fmt.Println(" - Feature: Add -sprite-overlay to move excess colors of koala and hires to sprites.")
+	fmt.Println(" - Feature: Add -sprite-dedup, -sprite-mirror and -sprite-trim with a sprite index table.")
+	fmt.Println(" - Feature: Add -sprite-address and -sprite-names for sprite pointer symbols.")
+	fmt.Println(" - Feature: Add a frame delay table and a displayer to sprite animations.")
 	fmt.Println()
 	fmt.Println("## Changes for version 1.10.1")
 	fmt.Println()
@@ -0,0 +1,116 @@
+package png2prg
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"slices"
+)
+
+// An ECMPETSCIICharset is an ecm screen using the first 64 chars of a rom charset,
+// so no charset data is stored. Each char selects one of the 4 background colors d021-d024.
+type ECMPETSCIICharset struct {
+	SourceFilename  string
+	ROMCharset      string // name of the rom charset, see -rom-charsets
+	Lowercase       byte   // 0 = uppercase, 1 = lowercase
+	Screen          [1000]byte
+	D800Color       [1000]byte
+	BorderColor     byte
+	BackgroundColor byte
+	D022Color       byte
+	D023Color       byte
+	D024Color       byte
+	romChars        []charBytes
+	opt             Options
+}
+
+// ECMPETSCIICharset converts the img to ECMPETSCIICharset and returns it.
+// The rom charsets are tried in order, see -rom-charsets.
+func (img *sourceImage) ECMPETSCIICharset() (ECMPETSCIICharset, error) {
+	c := ECMPETSCIICharset{
+		SourceFilename: img.sourceFilename,
+		opt:            img.opt,
+	}
+	rom := *img
+	rom.graphicsType = ecmCharset
+	// empty chars must stay empty, as there is no filled char in the first 64 rom chars.
+	rom.opt.NoPackEmptyChar = true
+	rom.opt.Quiet = true
+	var err error
+	for _, r := range img.opt.romCharsets() {
+		if len(r.Chars) < MaxECMChars {
+			err = fmt.Errorf("the %s rom charset contains %d chars, ecm requires %d", r.Name, len(r.Chars), MaxECMChars)
+			continue
+		}
+		// clip the rom chars, so appending to them never writes into the shared rom charset.
+		chars := slices.Clip(r.Chars[:MaxECMChars])
+		var ecm ECMCharset
+		if ecm, err = rom.ECMCharset(chars); err != nil {
+			if img.opt.Verbose {
+				log.Printf("rom.ECMCharset with the %s rom charset failed: %v", r.Name, err)
+			}
+			continue
+		}
+		c.ROMCharset, c.Lowercase, c.romChars = r.Name, r.Lowercase, chars
+		c.Screen, c.D800Color = ecm.Screen, ecm.D800Color
+		c.BorderColor, c.BackgroundColor = ecm.BorderColor, ecm.BackgroundColor
+		c.D022Color, c.D023Color, c.D024Color = ecm.D022Color, ecm.D023Color, ecm.D024Color
+		if !img.opt.Quiet {
+			fmt.Printf("converted to ecm petscii using the %s rom charset\n", c.ROMCharset)
+		}
+		return c, nil
+	}
+	return c, fmt.Errorf("image does not fit the first %d chars of the rom charsets: %w", MaxECMChars, err)
+}
+
+// Symbols includes the d018 value selecting the screenram and the rom charset in vic bank 0.
+func (c ECMPETSCIICharset) Symbols() []c64Symbol {
+	return append([]c64Symbol{
+		{"screenram", CharsetScreenRAMAddress},
+		{"colorram", CharsetColorRAMAddress},
+		{"d018", (CharsetScreenRAMAddress/0x400)<<4 | 0x04 | int(c.Lowercase)<<1},
+		{"d020color", int(c.BorderColor)},
+		{"d021color", int(c.BackgroundColor)},
+		{"d022color", int(c.D022Color)},
+		{"d023color", int(c.D023Color)},
+		{"d024color", int(c.D024Color)},
+	}, c.opt.romCharsetSymbols(c.ROMCharset, c.Lowercase)...)
+}
+
+// ECMCharset returns c as ECMCharset, including the first 64 rom chars as charset.
+// This allows the ecm displayer to show the image.
+func (c ECMPETSCIICharset) ECMCharset() ECMCharset {
+	ecm := ECMCharset{
+		SourceFilename:  c.SourceFilename,
+		Screen:          c.Screen,
+		D800Color:       c.D800Color,
+		BorderColor:     c.BorderColor,
+		BackgroundColor: c.BackgroundColor,
+		D022Color:       c.D022Color,
+		D023Color:       c.D023Color,
+		D024Color:       c.D024Color,
+		opt:             c.opt,
+	}
+	for i, char := range c.romChars {
+		for j := range char {
+			ecm.Bitmap[i*8+j] = char[j]
+		}
+	}
+	return ecm
+}
+
+func (c ECMPETSCIICharset) WriteTo(w io.Writer) (n int64, err error) {
+	if c.opt.Display {
+		return c.ECMCharset().WriteTo(w)
+	}
+	link := NewLinker(CharsetScreenRAMAddress, c.opt.VeryVerbose)
+	_, err = link.WriteMap(LinkMap{
+		CharsetScreenRAMAddress: c.Screen[:],
+		CharsetColorRAMAddress:  c.D800Color[:],
+		0x2fe8:                  []byte{c.BorderColor, c.BackgroundColor, c.D022Color, c.D023Color, c.D024Color},
+	})
+	if err != nil {
+		return n, fmt.Errorf("link.WriteMap failed: %w", err)
+	}
+	return link.WriteTo(w)
+}
@@ -0,0 +1,261 @@
+package png2prg
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	FontCharsetAddress = 0x2000
+	FontTableAddress   = 0x2800
+)
+
+// A Font is an unpacked charset converted from a glyph grid image, in PETSCII screencode order.
+// Multi-char glyphs of GlyphWidth x GlyphHeight chars use the index scheme screencode + part * PartOffset,
+// where part counts the chars of the glyph from left to right and top to bottom.
+// Table maps ASCII to screencodes, unmapped ASCII chars map to the space.
+type Font struct {
+	SourceFilename  string
+	GraphicsType    GraphicsType
+	GlyphWidth      int
+	GlyphHeight     int
+	PartOffset      int
+	NumGlyphs       int
+	Bitmap          [0x800]byte
+	Table           [128]byte
+	BackgroundColor byte
+	D022Color       byte
+	D023Color       byte
+	CharColor       byte
+	codes           []int
+	opt             Options
+}
+
+// parseFontSize parses the -font string in format "wxh", eg 1x1, 1x2 or 2x2 chars per glyph.
+func parseFontSize(in string) (w, h int, err error) {
+	a, b, ok := strings.Cut(in, "x")
+	if !ok {
+		return 0, 0, fmt.Errorf("incorrect font size %q, use 1x1, 1x2, 2x1 or 2x2", in)
+	}
+	if w, err = strconv.Atoi(a); err != nil {
+		return 0, 0, fmt.Errorf("strconv.Atoi conversion of %q to integer failed: %w", a, err)
+	}
+	if h, err = strconv.Atoi(b); err != nil {
+		return 0, 0, fmt.Errorf("strconv.Atoi conversion of %q to integer failed: %w", b, err)
+	}
+	if w < 1 || w > 2 || h < 1 || h > 2 {
+		return 0, 0, fmt.Errorf("unsupported font size %q, use 1x1, 1x2, 2x1 or 2x2", in)
+	}
+	return w, h, nil
+}
+
+// asciiToScreencode returns the PETSCII screencode of ASCII char r, lowercase letters map to uppercase.
+func asciiToScreencode(r rune) (int, bool) {
+	switch {
+	case r >= '@' && r <= '_':
+		return int(r - '@'), true
+	case r >= 'a' && r <= 'z':
+		return int(r-'a') + 1, true
+	case r >= ' ' && r <= '?':
+		return int(r), true
+	}
+	return 0, false
+}
+
+// NewFont returns the Font of the glyph grid sheet according to opt.Font and opt.FontMap.
+// Without opt.FontMap the glyphs are in screencode order, otherwise opt.FontMap contains the ASCII chars of the glyphs in the sheet.
+func NewFont(opt Options, sourceFilename string, sheet image.Image) (*Font, error) {
+	f := &Font{SourceFilename: sourceFilename, opt: opt}
+	var err error
+	if f.GlyphWidth, f.GlyphHeight, err = parseFontSize(opt.Font); err != nil {
+		return nil, fmt.Errorf("parseFontSize failed: %w", err)
+	}
+	f.PartOffset = MaxChars / (f.GlyphWidth * f.GlyphHeight)
+	b := sheet.Bounds()
+	cellw, cellh := f.GlyphWidth*8, f.GlyphHeight*8
+	if b.Dx()%cellw != 0 || b.Dy()%cellh != 0 {
+		return nil, fmt.Errorf("font image resolution %dx%d is not a multiple of %dx%d pixel glyphs", b.Dx(), b.Dy(), cellw, cellh)
+	}
+	f.NumGlyphs = (b.Dx() / cellw) * (b.Dy() / cellh)
+
+	space := -1
+	if opt.FontMap == "" {
+		for i := 0; i < f.NumGlyphs; i++ {
+			f.codes = append(f.codes, i)
+		}
+		if f.NumGlyphs > ' ' {
+			space = ' '
+		}
+	} else {
+		used := map[int]rune{}
+		for _, r := range opt.FontMap {
+			code, ok := asciiToScreencode(r)
+			if !ok {
+				return nil, fmt.Errorf("-font-map char %q has no screencode", r)
+			}
+			if prev, ok := used[code]; ok {
+				return nil, fmt.Errorf("-font-map chars %q and %q map to the same screencode %d", prev, r, code)
+			}
+			used[code] = r
+			f.codes = append(f.codes, code)
+			if r == ' ' {
+				space = code
+			}
+		}
+		if len(f.codes) > f.NumGlyphs {
+			return nil, fmt.Errorf("-font-map contains %d chars, but the image contains only %d glyphs", len(f.codes), f.NumGlyphs)
+		}
+	}
+	if len(f.codes) > f.PartOffset {
+		f.codes = f.codes[:f.PartOffset]
+	}
+	for _, code := range f.codes {
+		if code >= f.PartOffset {
+			return nil, fmt.Errorf("screencode %d does not fit in a %s font, the max is %d", code, opt.Font, f.PartOffset-1)
+		}
+	}
+
+	mapped := map[int]bool{}
+	for _, code := range f.codes {
+		mapped[code] = true
+	}
+	for i := range f.Table {
+		f.Table[i] = byte(space)
+		if space < 0 {
+			f.Table[i] = 0
+		}
+		if code, ok := asciiToScreencode(rune(i)); ok && mapped[code] {
+			f.Table[i] = byte(code)
+		}
+	}
+	return f, nil
+}
+
+// layout returns a 320x200 image with the chars of all glyphs in sheet at their char index on screen,
+// so the chars can be converted in order with -no-pack.
+func (f *Font) layout(sheet image.Image) *image.RGBA {
+	b := sheet.Bounds()
+	count := map[colorKey]int{}
+	var bg color.Color = color.RGBA{}
+	max := 0
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			k := ColorKey(sheet.At(x, y))
+			count[k]++
+			if count[k] > max {
+				max = count[k]
+				bg = sheet.At(x, y)
+			}
+		}
+	}
+	out := image.NewRGBA(image.Rect(0, 0, FullScreenWidth, FullScreenHeight))
+	for y := 0; y < FullScreenHeight; y++ {
+		for x := 0; x < FullScreenWidth; x++ {
+			out.Set(x, y, bg)
+		}
+	}
+	cols := b.Dx() / (f.GlyphWidth * 8)
+	for glyph, code := range f.codes {
+		gx, gy := b.Min.X+(glyph%cols)*f.GlyphWidth*8, b.Min.Y+(glyph/cols)*f.GlyphHeight*8
+		for py := 0; py < f.GlyphHeight; py++ {
+			for px := 0; px < f.GlyphWidth; px++ {
+				char := code + (py*f.GlyphWidth+px)*f.PartOffset
+				cx, cy := (char%40)*8, (char/40)*8
+				for y := 0; y < 8; y++ {
+					for x := 0; x < 8; x++ {
+						out.Set(cx+x, cy+y, sheet.At(gx+px*8+x, gy+py*8+y))
+					}
+				}
+			}
+		}
+	}
+	return out
+}
+
+// WriteFontTo converts the font sheet to a sc or mc charset and writes the resulting Font .prg to w.
+func (c *Converter) WriteFontTo(w io.Writer) (n int64, err error) {
+	f := c.font
+	opt := c.opt
+	opt.NoPackChars = true
+	f.GraphicsType = singleColorCharset
+	if c.opt.CurrentGraphicsType == multiColorCharset {
+		f.GraphicsType = multiColorCharset
+	}
+	opt.GraphicsMode, opt.CurrentGraphicsType = f.GraphicsType.String(), f.GraphicsType
+	img, err := NewSourceImage(opt, 0, f.layout(c.fontSheet))
+	if err != nil {
+		return n, fmt.Errorf("NewSourceImage %q failed: %w", f.SourceFilename, err)
+	}
+	img.sourceFilename = f.SourceFilename
+	if err = img.analyze(); err != nil {
+		return n, fmt.Errorf("analyze %q failed: %w", f.SourceFilename, err)
+	}
+	if f.GraphicsType == multiColorCharset {
+		ch, err := img.MultiColorCharset(nil)
+		if err != nil {
+			return n, fmt.Errorf("img.MultiColorCharset %q failed: %w", f.SourceFilename, err)
+		}
+		f.Bitmap = ch.Bitmap
+		f.BackgroundColor, f.D022Color, f.D023Color, f.CharColor = ch.BackgroundColor, ch.D022Color, ch.D023Color, ch.CharColor
+	} else {
+		ch, err := img.SingleColorCharset(nil)
+		if err != nil {
+			return n, fmt.Errorf("img.SingleColorCharset %q failed: %w", f.SourceFilename, err)
+		}
+		f.Bitmap = ch.Bitmap
+		f.BackgroundColor = ch.BackgroundColor
+		for _, col := range img.p.SortColors() {
+			if byte(col.C64Color) != f.BackgroundColor {
+				f.CharColor = byte(col.C64Color)
+				break
+			}
+		}
+	}
+	c.FinalGraphicsType = f.GraphicsType
+	if !c.opt.Quiet {
+		fmt.Printf("converted %d %dx%d glyphs to %s font, chars of a glyph are %d apart\n", len(f.codes), f.GlyphWidth, f.GlyphHeight, f.GraphicsType, f.PartOffset)
+	}
+	if c.opt.Symbols {
+		c.Symbols = append(c.Symbols, f.Symbols()...)
+	}
+	return f.WriteTo(w)
+}
+
+func (f Font) Symbols() []c64Symbol {
+	syms := []c64Symbol{
+		{"bitmap", FontCharsetAddress},
+		{"fonttable", FontTableAddress},
+		{"glyphs", len(f.codes)},
+		{"glyphwidth", f.GlyphWidth},
+		{"glyphheight", f.GlyphHeight},
+		{"glyphpartoffset", f.PartOffset},
+		{"d021color", int(f.BackgroundColor)},
+		{"charcolor", int(f.CharColor)},
+	}
+	if f.GraphicsType == multiColorCharset {
+		syms = append(syms, []c64Symbol{
+			{"d022color", int(f.D022Color)},
+			{"d023color", int(f.D023Color)},
+		}...)
+	}
+	return syms
+}
+
+func (f Font) WriteTo(w io.Writer) (n int64, err error) {
+	if f.opt.Display {
+		return n, fmt.Errorf("there is no displayer for -font, omit -display")
+	}
+	link := NewLinker(FontCharsetAddress, f.opt.VeryVerbose)
+	_, err = link.WriteMap(LinkMap{
+		FontCharsetAddress: f.Bitmap[:],
+		FontTableAddress:   f.Table[:],
+	})
+	if err != nil {
+		return n, fmt.Errorf("link.WriteMap failed: %w", err)
+	}
+	return link.WriteTo(w)
+}
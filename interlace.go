@@ -3,8 +3,11 @@ package png2prg
 import (
 	"fmt"
 	"image"
+	"image/color"
 	"io"
 	"log"
+	"math/bits"
+	"slices"
 	"time"
 )
 
@@ -315,3 +318,286 @@ func (img1 *sourceImage) InterlaceKoala(img0 sourceImage) (k0, k1 Koala, sharedc
 	}
 	return k0, k1, sharedcolors, nil
 }
+
+// WriteHiresInterlaceTo converts the 2 hires images and writes the resulting hires interlace .prg to w.
+// Where possible, the screenram colors of the second frame are aligned with the first frame.
+func (c *Converter) WriteHiresInterlaceTo(w io.Writer) (n int64, err error) {
+	if len(c.images) != 2 {
+		return n, fmt.Errorf("hires interlace requires exactly 2 images at this stage, not %d", len(c.images))
+	}
+	if c.opt.Display {
+		return n, fmt.Errorf("there is no displayer for hires interlace, omit -display")
+	}
+	img0 := &c.images[0]
+	img1 := &c.images[1]
+	if err = img1.analyze(); err != nil {
+		return n, fmt.Errorf("analyze %q failed: %w", img1.sourceFilename, err)
+	}
+	h0, err := img0.Hires()
+	if err != nil {
+		return n, fmt.Errorf("img0.Hires %q failed: %w", img0.sourceFilename, err)
+	}
+	h1, err := img1.Hires()
+	if err != nil {
+		return n, fmt.Errorf("img1.Hires %q failed: %w", img1.sourceFilename, err)
+	}
+
+	for char := 0; char < FullScreenChars; char++ {
+		fg0, bg0 := C64Color(h0.ScreenColor[char]>>4), C64Color(h0.ScreenColor[char]&0xf)
+		bp := &bitpairs{bitpairs: []byte{0, 1}}
+		aligned := true
+		for _, col := range img1.charColors[char] {
+			switch col.C64Color {
+			case bg0:
+				bp.add(0, col)
+			case fg0:
+				bp.add(1, col)
+			default:
+				aligned = false
+			}
+		}
+		if !aligned {
+			continue
+		}
+		cbuf, err := img1.singleColorCharBytes(char, bp)
+		if err != nil {
+			return n, fmt.Errorf("singleColorCharBytes failed: %w", err)
+		}
+		for i := range cbuf {
+			h1.Bitmap[char*8+i] = cbuf[i]
+		}
+		h1.ScreenColor[char] = h0.ScreenColor[char]
+	}
+	if !c.opt.Quiet {
+		fmt.Printf("shared screenram: %v shared bitmap: %v\n", h0.ScreenColor == h1.ScreenColor, h0.Bitmap == h1.Bitmap)
+	}
+
+	if c.opt.Symbols {
+		c.Symbols = []c64Symbol{
+			{"screenram1", 0x9c00},
+			{"d020coloraddr", 0x9fe8},
+			{"bitmap1", 0xa000},
+			{"bitmap2", 0xc000},
+			{"screenram2", 0xe000},
+			{"d020color", int(h0.BorderColor)},
+		}
+	}
+	link := NewLinker(0, c.opt.VeryVerbose)
+	_, err = link.WriteMap(LinkMap{
+		0x9c00: h0.ScreenColor[:],
+		0x9fe8: []byte{h0.BorderColor},
+		0xa000: h0.Bitmap[:],
+		0xc000: h1.Bitmap[:],
+		0xe000: h1.ScreenColor[:],
+	})
+	if err != nil {
+		return n, fmt.Errorf("link.WriteMap failed: %w", err)
+	}
+	return link.WriteTo(w)
+}
+
+// A blendedPair is a pair of Colors and the average of both, as perceived when interlacing.
+type blendedPair struct {
+	col0, col1 Color
+	blend      Color
+}
+
+// blendedPairs returns all possible blendedPairs of the palette colors, including pairs of the same color.
+func blendedPairs(cc Colors) (pairs []blendedPair) {
+	for i := range cc {
+		for j := i; j < len(cc); j++ {
+			r0, g0, b0, _ := cc[i].RGBA()
+			r1, g1, b1, _ := cc[j].RGBA()
+			avg := color.RGBA{byte(((r0 & 0xff) + (r1 & 0xff)) / 2), byte(((g0 & 0xff) + (g1 & 0xff)) / 2), byte(((b0 & 0xff) + (b1 & 0xff)) / 2), 0xff}
+			pairs = append(pairs, blendedPair{col0: cc[i], col1: cc[j], blend: Color{Color: avg}})
+		}
+	}
+	return pairs
+}
+
+// blendTolerance is the max rgb distance between blendedPairs, considered to be the same blended color.
+const blendTolerance = 6
+
+// closestBlendedPair returns the blendedPair closest to col and its distance.
+// Of the pairs within blendTolerance, the pair with the least luminance difference is preferred to minimize flicker.
+func closestBlendedPair(pairs []blendedPair, col color.Color) (found blendedPair, distance int) {
+	distance = int(9e8)
+	for _, p := range pairs {
+		if d := p.blend.Distance(col); d < distance {
+			found, distance = p, d
+		}
+	}
+	for _, p := range pairs {
+		if d := p.blend.Distance(col); d <= distance+blendTolerance && p.flicker() < found.flicker() {
+			found = p
+		}
+	}
+	return found, found.blend.Distance(col)
+}
+
+// flicker returns the luminance difference between both colors of the pair.
+func (p blendedPair) flicker() int {
+	d := lumaLevels[p.col0.C64Color&0xf] - lumaLevels[p.col1.C64Color&0xf]
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+// SplitBlendedImage splits an image with blended colors into 2 interlace frames.
+// Each blended color is matched to the closest average of 2 c64 colors, using the best matching palette.
+func SplitBlendedImage(opt Options, in image.Image) (*image.RGBA, *image.RGBA, error) {
+	img := sourceImage{opt: opt, image: in}
+	if err := img.checkBounds(); err != nil {
+		return nil, nil, fmt.Errorf("img.checkBounds failed: %w", err)
+	}
+	cc := map[colorKey]color.Color{}
+	for y := 0; y < FullScreenHeight; y++ {
+		for x := 0; x < FullScreenWidth; x++ {
+			col := img.At(x, y)
+			cc[ColorKey(col)] = col
+		}
+	}
+
+	var found map[colorKey]blendedPair
+	minDistance := int(9e8)
+	for _, src := range paletteSources {
+		m := map[colorKey]blendedPair{}
+		pairs := blendedPairs(src.Colors)
+		total := 0
+		for k, col := range cc {
+			p, distance := closestBlendedPair(pairs, col)
+			m[k] = p
+			total += distance
+		}
+		if opt.Verbose {
+			log.Printf("blended palette %q distance = %d", src.Name, total)
+		}
+		if total < minDistance {
+			found, minDistance = m, total
+		}
+	}
+	if opt.Verbose {
+		for k, p := range found {
+			log.Printf("blended color %s is %s + %s", rgbString(cc[k]), p.col0, p.col1)
+		}
+	}
+
+	charPairs := [FullScreenChars][]blendedPair{}
+	sumColors := [MaxColors]int{}
+	for char := 0; char < FullScreenChars; char++ {
+		x0, y0 := xyFromChar(char)
+		var cols uint16
+		for y := y0; y < y0+8; y++ {
+			for x := x0; x < x0+8; x++ {
+				p := found[ColorKey(img.At(x, y))]
+				if !slices.Contains(charPairs[char], p) {
+					charPairs[char] = append(charPairs[char], p)
+				}
+				cols |= 1<<(p.col0.C64Color&0xf) | 1<<(p.col1.C64Color&0xf)
+			}
+		}
+		for col := range sumColors {
+			if cols&(1<<col) != 0 {
+				sumColors[col]++
+			}
+		}
+	}
+	// multicolor frames share the background color, the color used by most chars.
+	maxColors, shared := 4, uint16(0)
+	if opt.CurrentGraphicsType == singleColorBitmap {
+		maxColors = 2
+	} else {
+		bg := 0
+		for col := range sumColors {
+			if sumColors[col] > sumColors[bg] {
+				bg = col
+			}
+		}
+		shared = 1 << bg
+	}
+
+	new0 := image.NewRGBA(image.Rect(0, 0, FullScreenWidth, FullScreenHeight))
+	new1 := image.NewRGBA(image.Rect(0, 0, FullScreenWidth, FullScreenHeight))
+	overflow := 0
+	for char := 0; char < FullScreenChars; char++ {
+		x0, y0 := xyFromChar(char)
+		pairs := charPairs[char]
+		swap, ok := balanceBlendedPairs(pairs, maxColors, shared)
+		if !ok {
+			overflow++
+		}
+		for y := y0; y < y0+8; y++ {
+			for x := x0; x < x0+8; x++ {
+				p := found[ColorKey(img.At(x, y))]
+				if swap[slices.Index(pairs, p)] {
+					p.col0, p.col1 = p.col1, p.col0
+				}
+				new0.Set(x, y, p.col0)
+				new1.Set(x, y, p.col1)
+			}
+		}
+	}
+	if overflow > 0 && !opt.Quiet {
+		fmt.Printf("warning: %d chars need more than %d colors per frame\n", overflow, maxColors)
+	}
+	return new0, new1, nil
+}
+
+// maxBalancedPairs is the max number of pairs per char to try all combinations of, more pairs are balanced greedily.
+const maxBalancedPairs = 12
+
+// balanceBlendedPairs decides for each pair of a char which color is shown in which frame.
+// swap[i] is true if col1 of pairs[i] goes to the first frame.
+// The number of colors per frame is kept within maxColors where possible, then the total number of colors is minimized.
+// The shared colors, like the background color of multicolor bitmaps, are always available and count as 1 color each.
+// Returns false if a frame still needs more than maxColors.
+func balanceBlendedPairs(pairs []blendedPair, maxColors int, shared uint16) (swap []bool, ok bool) {
+	maxColors -= bits.OnesCount16(shared)
+	cost := func(cols0, cols1 uint16) int {
+		n0, n1 := bits.OnesCount16(cols0&^shared), bits.OnesCount16(cols1&^shared)
+		excess := 0
+		if n0 > maxColors {
+			excess += n0 - maxColors
+		}
+		if n1 > maxColors {
+			excess += n1 - maxColors
+		}
+		return excess*1000 + n0 + n1
+	}
+	add := func(cols0, cols1 uint16, p blendedPair, swapped bool) (uint16, uint16) {
+		if swapped {
+			return cols0 | 1<<(p.col1.C64Color&0xf), cols1 | 1<<(p.col0.C64Color&0xf)
+		}
+		return cols0 | 1<<(p.col0.C64Color&0xf), cols1 | 1<<(p.col1.C64Color&0xf)
+	}
+
+	swap = make([]bool, len(pairs))
+	if len(pairs) > maxBalancedPairs {
+		var cols0, cols1 uint16
+		for i, p := range pairs {
+			a0, a1 := add(cols0, cols1, p, false)
+			b0, b1 := add(cols0, cols1, p, true)
+			if cost(b0, b1) < cost(a0, a1) {
+				swap[i], cols0, cols1 = true, b0, b1
+			} else {
+				cols0, cols1 = a0, a1
+			}
+		}
+		return swap, cost(cols0, cols1) < 1000
+	}
+	best, bestCost := 0, int(9e8)
+	for mask := 0; mask < 1<<len(pairs); mask++ {
+		var cols0, cols1 uint16
+		for i, p := range pairs {
+			cols0, cols1 = add(cols0, cols1, p, mask&(1<<i) != 0)
+		}
+		if c := cost(cols0, cols1); c < bestCost {
+			best, bestCost = mask, c
+		}
+	}
+	for i := range pairs {
+		swap[i] = best&(1<<i) != 0
+	}
+	return swap, bestCost < 1000
+}
@@ -0,0 +1,42 @@
+package png2prg
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBalanceBlendedPairs(t *testing.T) {
+	t.Parallel()
+	pair := func(col0, col1 C64Color) blendedPair {
+		return blendedPair{col0: Color{C64Color: col0}, col1: Color{C64Color: col1}}
+	}
+	// without swapping, the first frame would need 1, 2 and 3, the second 4, 5 and 6.
+	pairs := []blendedPair{pair(1, 4), pair(2, 5), pair(3, 6)}
+	swap, ok := balanceBlendedPairs(pairs, 2, 0)
+	assert.False(t, ok)
+	assert.Len(t, swap, 3)
+
+	// 1+4 and 4+1 fit in 2 colors per frame, if one of the pairs is swapped.
+	pairs = []blendedPair{pair(1, 4), pair(4, 1), pair(1, 1)}
+	swap, ok = balanceBlendedPairs(pairs, 2, 0)
+	assert.True(t, ok)
+	assert.NotEqual(t, swap[0], swap[1])
+
+	// the shared background color 0 leaves 3 colors per frame.
+	pairs = []blendedPair{pair(0, 1), pair(2, 3), pair(5, 2), pair(3, 7)}
+	swap, ok = balanceBlendedPairs(pairs, 4, 1<<0)
+	assert.True(t, ok)
+	cols := [2]map[C64Color]bool{{}, {}}
+	for i, p := range pairs {
+		c0, c1 := p.col0.C64Color, p.col1.C64Color
+		if swap[i] {
+			c0, c1 = c1, c0
+		}
+		cols[0][c0], cols[1][c1] = true, true
+	}
+	delete(cols[0], 0)
+	delete(cols[1], 0)
+	assert.LessOrEqual(t, len(cols[0]), 3)
+	assert.LessOrEqual(t, len(cols[1]), 3)
+}
@@ -0,0 +1,184 @@
+package png2prg
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"sort"
+	"strconv"
+)
+
+// LayeredSprites stores each sprite of the sheet as a multicolor sprite with a singlecolor sprite on top,
+// for hires outlines and details.
+// The multicolor sprites are stored first, followed by the hires sprites in the same order,
+// so multicolor sprite n is paired with sprite n + Columns * Rows.
+type LayeredSprites struct {
+	SourceFilename string
+	MultiColor     MultiColorSprites
+	Hires          []byte // hires sprites on top of the multicolor sprites
+	HiresColors    []byte // individual color of each hires sprite
+	opt            Options
+}
+
+func (s LayeredSprites) Symbols() []c64Symbol {
+	num := int(s.MultiColor.Columns) * int(s.MultiColor.Rows)
+	syms := []c64Symbol{
+		{"bitmap", s.opt.spriteAddress()},
+		{"columns", int(s.MultiColor.Columns)},
+		{"rows", int(s.MultiColor.Rows)},
+		{"numsprites", num},
+		{"hiresbitmap", s.opt.spriteAddress() + len(s.MultiColor.Bitmap)},
+		{"d021color", int(s.MultiColor.BackgroundColor)},
+		{"d025color", int(s.MultiColor.D025Color)},
+		{"d026color", int(s.MultiColor.D026Color)},
+	}
+	syms = append(syms, spriteExpansionSymbols(s.MultiColor.ExpandX, s.MultiColor.ExpandY)...)
+	bitmap := append(append([]byte{}, s.MultiColor.Bitmap...), s.Hires...)
+	colors := append(append([]byte{}, s.MultiColor.Colors...), s.HiresColors...)
+	return append(syms, spriteTableSymbols(s.opt, bitmap, colors, s.MultiColor.Index, s.MultiColor.ObjectWidth, s.MultiColor.ObjectHeight)...)
+}
+
+func (s LayeredSprites) WriteTo(w io.Writer) (n int64, err error) {
+	if s.opt.Display {
+		return n, fmt.Errorf("layered sprites have no displayer support")
+	}
+	return writeData(w, spriteHeader(s.opt), s.MultiColor.Bitmap, s.Hires, s.MultiColor.Colors, s.HiresColors, s.MultiColor.Index)
+}
+
+// hiresLayerColor returns the color of the hires sprite on top of the sprite at x0, y0.
+// Each pair of pixels with different colors needs to include this color, the other pixels are left to the multicolor sprite.
+// If the sprite has no hires pixels, ok is false.
+func (img *sourceImage) hiresLayerColor(x0, y0 int) (col C64Color, ok bool, err error) {
+	var candidates map[C64Color]bool
+	count := [MaxColors]int{}
+	for y := 0; y < SpriteHeight; y++ {
+		for x := 0; x < SpriteWidth; x += 2 {
+			a, err := img.p.FromColor(img.At(x0+x, y0+y))
+			if err != nil {
+				return 0, false, fmt.Errorf("img.p.FromColor failed: %w", err)
+			}
+			b, err := img.p.FromColor(img.At(x0+x+1, y0+y))
+			if err != nil {
+				return 0, false, fmt.Errorf("img.p.FromColor failed: %w", err)
+			}
+			count[a.C64Color]++
+			count[b.C64Color]++
+			if a.C64Color == b.C64Color {
+				continue
+			}
+			pair := map[C64Color]bool{}
+			for _, c := range []C64Color{a.C64Color, b.C64Color} {
+				if c != img.bg.C64Color && (candidates == nil || candidates[c]) {
+					pair[c] = true
+				}
+			}
+			if len(pair) == 0 {
+				return 0, false, fmt.Errorf("sprite at x=%d y=%d needs more than 1 hires color, found at x=%d y=%d", x0, y0, x0+x, y0+y)
+			}
+			candidates = pair
+		}
+	}
+	if candidates == nil {
+		return 0, false, nil
+	}
+	cc := make([]C64Color, 0, len(candidates))
+	for c := range candidates {
+		cc = append(cc, c)
+	}
+	// prefer the least used color, as outlines and details use fewer pixels.
+	sort.Slice(cc, func(i, j int) bool {
+		if count[cc[i]] == count[cc[j]] {
+			return cc[i] < cc[j]
+		}
+		return count[cc[i]] < count[cc[j]]
+	})
+	return cc[0], true, nil
+}
+
+// LayeredSprites converts the img to LayeredSprites and returns it.
+// All pixels in the color of the hires sprite are drawn by the hires sprite,
+// the multicolor sprite below fills in the other pixel of each pair, or the background color.
+func (img *sourceImage) LayeredSprites() (LayeredSprites, error) {
+	s := LayeredSprites{
+		SourceFilename: img.sourceFilename,
+		opt:            img.opt,
+	}
+	maxX, maxY := img.width/SpriteWidth, img.height/SpriteHeight
+	if maxX == 0 || maxY == 0 {
+		return s, fmt.Errorf("%d Xsprites x %d Ysprites: cant have 0 sprites", maxX, maxY)
+	}
+	if img.opt.SpriteDedup || img.opt.SpriteMirror || img.opt.SpriteTrim {
+		return s, fmt.Errorf("-sprite-dedup, -sprite-mirror and -sprite-trim are not supported for layered sprites")
+	}
+
+	bottom := image.NewRGBA(image.Rect(0, 0, img.width, img.height))
+	for spriteY := 0; spriteY < maxY; spriteY++ {
+		for spriteX := 0; spriteX < maxX; spriteX++ {
+			x0, y0 := spriteX*SpriteWidth, spriteY*SpriteHeight
+			col, ok, err := img.hiresLayerColor(x0, y0)
+			if err != nil {
+				return s, fmt.Errorf("img.hiresLayerColor failed: %w", err)
+			}
+			isHires := func(x, y int) bool {
+				return ok && img.p.FromColorNoErr(img.At(x, y)).C64Color == col
+			}
+			for y := y0; y < y0+SpriteHeight; y++ {
+				for x := x0; x < x0+SpriteWidth; x += 8 {
+					bmpbyte := byte(0)
+					for pixel := 0; pixel < 8; pixel++ {
+						if isHires(x+pixel, y) {
+							bmpbyte |= 1 << (7 - byte(pixel))
+						}
+					}
+					s.Hires = append(s.Hires, bmpbyte)
+				}
+				for x := x0; x < x0+SpriteWidth; x += 2 {
+					c := img.At(x, y)
+					switch {
+					case isHires(x, y) && isHires(x+1, y):
+						c = img.bg
+					case isHires(x, y):
+						c = img.At(x+1, y)
+					}
+					bottom.Set(x, y, c)
+					bottom.Set(x+1, y, c)
+				}
+			}
+			if !ok {
+				col = img.bg.C64Color
+			}
+			// SpritePad convention: individual color in the low nibble, bit 7 cleared for singlecolor.
+			s.Hires = append(s.Hires, byte(col))
+			s.HiresColors = append(s.HiresColors, byte(col))
+		}
+	}
+	if img.opt.Verbose {
+		log.Printf("hires sprite colors: %v\n", s.HiresColors)
+	}
+
+	opt := img.opt
+	opt.GraphicsMode, opt.CurrentGraphicsType = multiColorSprites.String(), multiColorSprites
+	// the -sprite-names cover both layers, see s.Symbols.
+	opt.spriteNames, opt.keepSpriteColors = nil, true
+	if opt.BitpairColorsString == "" {
+		opt.BitpairColorsString = strconv.Itoa(int(img.bg.C64Color))
+	}
+	mc, err := NewSourceImage(opt, 0, bottom)
+	if err != nil {
+		return s, fmt.Errorf("NewSourceImage %q failed: %w", img.sourceFilename, err)
+	}
+	mc.sourceFilename = img.sourceFilename + " multicolor layer"
+	mc.expand = img.expand
+	if err = mc.analyze(); err != nil {
+		return s, fmt.Errorf("analyze %q failed: %w", mc.sourceFilename, err)
+	}
+	if s.MultiColor, err = mc.MultiColorSprites(); err != nil {
+		return s, fmt.Errorf("mc.MultiColorSprites %q failed: %w", mc.sourceFilename, err)
+	}
+	size := len(s.MultiColor.Bitmap) + len(s.Hires)
+	if err = checkSpriteMemory(img.opt, size, size/64); err != nil {
+		return s, fmt.Errorf("checkSpriteMemory failed: %w", err)
+	}
+	return s, nil
+}
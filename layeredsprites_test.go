@@ -0,0 +1,86 @@
+package png2prg
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testLayeredSheet returns a sprite sheet with the pixels of rows, background color 0 elsewhere.
+func testLayeredSheet(t *testing.T, rows []string) *sourceImage {
+	rgb := map[C64Color]color.RGBA{
+		0: {0x00, 0x00, 0x00, 0xff},
+		1: {0xff, 0xff, 0xff, 0xff},
+		2: {0xb5, 0x61, 0x48, 0xff},
+		3: {0x99, 0xe6, 0xf9, 0xff},
+		4: {0xc1, 0x61, 0xc9, 0xff},
+	}
+	im := image.NewRGBA(image.Rect(0, 0, 2*SpriteWidth, SpriteHeight))
+	for y := 0; y < SpriteHeight; y++ {
+		for x := 0; x < 2*SpriteWidth; x++ {
+			col := C64Color(0)
+			if y < len(rows) && x < len(rows[y]) && rows[y][x] != '.' {
+				col = C64Color(rows[y][x] - '0')
+			}
+			im.Set(x, y, rgb[col])
+		}
+	}
+	img, err := NewSourceImage(Options{Quiet: true, GraphicsMode: "layeredsprites", CurrentGraphicsType: layeredSprites}, 0, im)
+	require.Nil(t, err)
+	require.Nil(t, img.analyze())
+	return &img
+}
+
+func TestLayeredSprites(t *testing.T) {
+	t.Parallel()
+	// the first sprite pairs hires+hires, hires+other, other+other and hires+bg,
+	// the second sprite has no hires pixels.
+	img := testLayeredSheet(t, []string{
+		"11122233................33",
+		"1.......................33",
+	})
+	s, err := img.LayeredSprites()
+	require.Nil(t, err)
+	assert.Equal(t, []byte{1, 0}, s.HiresColors)
+
+	// the hires layer draws all pixels of color 1.
+	require.Len(t, s.Hires, 2*64)
+	want := make([]byte, 2*64)
+	want[0], want[3], want[63] = 0xe0, 0x80, 1
+	assert.Equal(t, want, s.Hires)
+
+	// the multicolor layer gets the background color below hires+hires and hires+bg,
+	// the other color below hires+other.
+	mc := s.MultiColor.Bitmap
+	require.Len(t, mc, 2*64)
+	pair := func(b byte, i int) byte { return b >> (6 - 2*byte(i)) & 3 }
+	assert.Equal(t, byte(0), pair(mc[0], 0))
+	assert.NotEqual(t, byte(0), pair(mc[0], 1))
+	assert.Equal(t, pair(mc[0], 1), pair(mc[0], 2))
+	assert.NotEqual(t, byte(0), pair(mc[0], 3))
+	assert.NotEqual(t, pair(mc[0], 1), pair(mc[0], 3))
+	assert.Equal(t, byte(0), mc[3])
+	assert.Equal(t, pair(mc[0], 3), pair(mc[64], 0))
+	assert.Equal(t, byte(0x80), mc[63]&0x80)
+
+	syms := map[string]int{}
+	for _, sym := range s.Symbols() {
+		syms[sym.key] = sym.value
+	}
+	assert.Equal(t, 0x2000, syms["bitmap"])
+	assert.Equal(t, 0x2000+2*64, syms["hiresbitmap"])
+	assert.Equal(t, 2, syms["numsprites"])
+}
+
+func TestLayeredSpritesTooManyHiresColors(t *testing.T) {
+	t.Parallel()
+	img := testLayeredSheet(t, []string{
+		"1234",
+	})
+	_, err := img.LayeredSprites()
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "needs more than 1 hires color")
+}
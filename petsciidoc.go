@@ -0,0 +1,376 @@
+package png2prg
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// errNotPETSCIIDocument is returned by decodePETSCIIDocument when the input is not a supported PETSCII editor document.
+var errNotPETSCIIDocument = errors.New("not a petscii document")
+
+// PETSCIIExportExtension returns the file extension of PETSCII export format, or .prg for unknown formats.
+func PETSCIIExportExtension(format string) string {
+	switch format {
+	case "petmate":
+		return ".petmate"
+	case "marq":
+		return ".c"
+	case "pet":
+		return ".pet"
+	case "seq":
+		return ".seq"
+	}
+	return ".prg"
+}
+
+// isPETSCIIExportFormat returns true if format is a supported -petscii-export format.
+func isPETSCIIExportFormat(format string) bool {
+	switch format {
+	case "petmate", "marq", "pet", "seq", "basic":
+		return true
+	}
+	return false
+}
+
+// petmateDocument is the json structure of a Petmate .petmate file.
+type petmateDocument struct {
+	Version     int               `json:"version"`
+	Screens     []int             `json:"screens"`
+	Framebufs   []petmateFramebuf `json:"framebufs"`
+	CustomFonts map[string]any    `json:"customFonts"`
+}
+
+type petmateFramebuf struct {
+	Width           int              `json:"width"`
+	Height          int              `json:"height"`
+	BackgroundColor byte             `json:"backgroundColor"`
+	BorderColor     byte             `json:"borderColor"`
+	Charset         string           `json:"charset"`
+	Name            string           `json:"name,omitempty"`
+	Framebuf        [][]petmatePixel `json:"framebuf"`
+}
+
+type petmatePixel struct {
+	Code  byte `json:"code"`
+	Color byte `json:"color"`
+}
+
+// decodePETSCIIDocument detects and decodes a Petmate .petmate, Marq's PETSCII .c or .pet document.
+// Each frame of the document is returned as PETSCIICharset.
+// Returns errNotPETSCIIDocument if bin is not a petscii document.
+func decodePETSCIIDocument(opt Options, name string, bin []byte) ([]PETSCIICharset, error) {
+	ext := strings.ToLower(filepath.Ext(name))
+	trimmed := bytes.TrimSpace(bin)
+	var cc []PETSCIICharset
+	var err error
+	switch {
+	case ext == ".petmate" || (bytes.HasPrefix(trimmed, []byte("{")) && bytes.Contains(bin, []byte(`"framebufs"`))):
+		cc, err = decodePetmate(opt, name, bin)
+	case ext == ".c" || bytes.Contains(bin, []byte("unsigned char")):
+		cc, err = decodeMarqC(opt, name, bin)
+	case ext == ".pet":
+		cc, err = decodePet(opt, name, bin)
+	default:
+		return nil, errNotPETSCIIDocument
+	}
+	if err != nil {
+		return nil, err
+	}
+	for i := range cc {
+		cc[i].ROMCharset = builtinROMCharsetName(cc[i].Lowercase)
+	}
+	return cc, nil
+}
+
+// petsciiCharsetLowercase returns 1 for the lowercase charset name and 0 for uppercase.
+func petsciiCharsetLowercase(charset string) (byte, error) {
+	switch charset {
+	case "upper", "":
+		return 0, nil
+	case "lower":
+		return 1, nil
+	}
+	return 0, fmt.Errorf("unsupported charset %q, only the upper and lower rom charsets are supported", charset)
+}
+
+func decodePetmate(opt Options, name string, bin []byte) (cc []PETSCIICharset, err error) {
+	doc := petmateDocument{}
+	if err = json.Unmarshal(bin, &doc); err != nil {
+		return nil, fmt.Errorf("json.Unmarshal %q failed: %w", name, err)
+	}
+	screens := doc.Screens
+	if len(screens) == 0 {
+		for i := range doc.Framebufs {
+			screens = append(screens, i)
+		}
+	}
+	for _, i := range screens {
+		if i < 0 || i >= len(doc.Framebufs) {
+			return nil, fmt.Errorf("screen %d not found in %q", i, name)
+		}
+		fb := doc.Framebufs[i]
+		if fb.Width != FullScreenWidth/8 || fb.Height != FullScreenHeight/8 || len(fb.Framebuf) != FullScreenHeight/8 {
+			return nil, fmt.Errorf("screen %d of %q is %dx%d chars, only 40x25 is supported", i, name, fb.Width, fb.Height)
+		}
+		c := PETSCIICharset{
+			SourceFilename:  fmt.Sprintf("%s:%d", name, i),
+			BorderColor:     fb.BorderColor & 0xf,
+			BackgroundColor: fb.BackgroundColor & 0xf,
+			opt:             opt,
+		}
+		if c.Lowercase, err = petsciiCharsetLowercase(fb.Charset); err != nil {
+			return nil, fmt.Errorf("screen %d of %q: %w", i, name, err)
+		}
+		for y, row := range fb.Framebuf {
+			if len(row) != FullScreenWidth/8 {
+				return nil, fmt.Errorf("row %d of screen %d of %q contains %d chars, not 40", y, i, name, len(row))
+			}
+			for x, p := range row {
+				c.Screen[y*40+x], c.D800Color[y*40+x] = p.Code, p.Color&0xf
+			}
+		}
+		cc = append(cc, c)
+	}
+	if len(cc) == 0 {
+		return nil, fmt.Errorf("no screens found in %q", name)
+	}
+	return cc, nil
+}
+
+// decodeMarqC decodes the C source exported by Marq's PETSCII editor.
+// Each frame is an unsigned char array of border, background, 1000 screencodes and 1000 colors.
+// The charset is found in the trailing META comment, eg: // META: 40 25 C64 upper
+func decodeMarqC(opt Options, name string, bin []byte) (cc []PETSCIICharset, err error) {
+	var lowercase byte
+	var frame []int
+	inFrame := false
+	s := bufio.NewScanner(bytes.NewReader(bin))
+	for s.Scan() {
+		line := s.Text()
+		code, comment, _ := strings.Cut(line, "//")
+		if fields := strings.Fields(comment); len(fields) == 5 && fields[0] == "META:" {
+			if fields[1] != "40" || fields[2] != "25" {
+				return nil, fmt.Errorf("%q is %sx%s chars, only 40x25 is supported", name, fields[1], fields[2])
+			}
+			if lowercase, err = petsciiCharsetLowercase(fields[4]); err != nil {
+				return nil, fmt.Errorf("%q: %w", name, err)
+			}
+		}
+		if _, after, ok := strings.Cut(code, "{"); ok {
+			inFrame, frame, code = true, nil, after
+		}
+		if !inFrame {
+			continue
+		}
+		end := false
+		if before, _, ok := strings.Cut(code, "}"); ok {
+			code, end = before, true
+		}
+		for _, v := range strings.Split(code, ",") {
+			if v = strings.TrimSpace(v); v == "" {
+				continue
+			}
+			i, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, fmt.Errorf("strconv.Atoi conversion of %q in %q failed: %w", v, name, err)
+			}
+			frame = append(frame, i)
+		}
+		if end {
+			inFrame = false
+			if len(frame) != 2+2*FullScreenChars {
+				return nil, fmt.Errorf("frame %d of %q contains %d values, not %d", len(cc), name, len(frame), 2+2*FullScreenChars)
+			}
+			c := PETSCIICharset{
+				SourceFilename:  fmt.Sprintf("%s:%d", name, len(cc)),
+				BorderColor:     byte(frame[0]) & 0xf,
+				BackgroundColor: byte(frame[1]) & 0xf,
+				opt:             opt,
+			}
+			for i := 0; i < FullScreenChars; i++ {
+				c.Screen[i], c.D800Color[i] = byte(frame[2+i]), byte(frame[2+FullScreenChars+i])&0xf
+			}
+			cc = append(cc, c)
+		}
+	}
+	if err = s.Err(); err != nil {
+		return nil, fmt.Errorf("scan %q failed: %w", name, err)
+	}
+	if len(cc) == 0 {
+		return nil, fmt.Errorf("no frames found in %q", name)
+	}
+	for i := range cc {
+		cc[i].Lowercase = lowercase
+	}
+	return cc, nil
+}
+
+// decodePet decodes .pet frames of width, height, border, background, charset (0 = upper, 1 = lower),
+// followed by the screencodes and colors. Multiple frames are stored consecutively.
+func decodePet(opt Options, name string, bin []byte) (cc []PETSCIICharset, err error) {
+	const size = 5 + 2*FullScreenChars
+	for len(bin) > 0 {
+		if len(bin) < size {
+			return nil, fmt.Errorf("frame %d of %q is truncated, %d bytes left", len(cc), name, len(bin))
+		}
+		if bin[0] != 40 || bin[1] != 25 {
+			return nil, fmt.Errorf("frame %d of %q is %dx%d chars, only 40x25 is supported", len(cc), name, bin[0], bin[1])
+		}
+		if bin[4] > 1 {
+			return nil, fmt.Errorf("frame %d of %q uses unsupported charset %d", len(cc), name, bin[4])
+		}
+		c := PETSCIICharset{
+			SourceFilename:  fmt.Sprintf("%s:%d", name, len(cc)),
+			BorderColor:     bin[2] & 0xf,
+			BackgroundColor: bin[3] & 0xf,
+			Lowercase:       bin[4],
+			opt:             opt,
+		}
+		copy(c.Screen[:], bin[5:5+FullScreenChars])
+		copy(c.D800Color[:], bin[5+FullScreenChars:size])
+		for i := range c.D800Color {
+			c.D800Color[i] &= 0xf
+		}
+		cc = append(cc, c)
+		bin = bin[size:]
+	}
+	if len(cc) == 0 {
+		return nil, fmt.Errorf("no frames found in %q", name)
+	}
+	return cc, nil
+}
+
+// EncodePETSCIIDocument writes the PETSCIICharset frames cc to w in the Petmate (petmate),
+// Marq's PETSCII C source (marq), .pet (pet), PETSCII stream (seq) or BASIC program (basic) format.
+// Only the builtin uppercase and lowercase rom charsets are supported.
+func EncodePETSCIIDocument(w io.Writer, format string, cc []PETSCIICharset) (n int64, err error) {
+	for i, c := range cc {
+		if c.ROMCharset != "" && !isBuiltinROMCharset(c.ROMCharset) {
+			return n, fmt.Errorf("frame %d uses the %q rom charset, petscii documents only support uppercase and lowercase", i, c.ROMCharset)
+		}
+	}
+	buf := &bytes.Buffer{}
+	switch format {
+	case "petmate":
+		doc := petmateDocument{Version: 2, CustomFonts: map[string]any{}}
+		for i, c := range cc {
+			fb := petmateFramebuf{
+				Width:           FullScreenWidth / 8,
+				Height:          FullScreenHeight / 8,
+				BackgroundColor: c.BackgroundColor,
+				BorderColor:     c.BorderColor,
+				Charset:         "upper",
+				Name:            fmt.Sprintf("screen_%03d", i+1),
+			}
+			if c.Lowercase == 1 {
+				fb.Charset = "lower"
+			}
+			for y := 0; y < FullScreenHeight/8; y++ {
+				row := make([]petmatePixel, FullScreenWidth/8)
+				for x := range row {
+					row[x] = petmatePixel{Code: c.Screen[y*40+x], Color: c.D800Color[y*40+x]}
+				}
+				fb.Framebuf = append(fb.Framebuf, row)
+			}
+			doc.Screens = append(doc.Screens, i)
+			doc.Framebufs = append(doc.Framebufs, fb)
+		}
+		enc := json.NewEncoder(buf)
+		if err = enc.Encode(doc); err != nil {
+			return n, fmt.Errorf("json.Encode failed: %w", err)
+		}
+	case "marq":
+		for i, c := range cc {
+			fmt.Fprintf(buf, "unsigned char frame%04d[]={// border,bg,chars,colors\n%d,%d,\n", i, c.BorderColor, c.BackgroundColor)
+			data := append(c.Screen[:], c.D800Color[:]...)
+			for j, v := range data {
+				sep := ","
+				switch {
+				case j == len(data)-1:
+					sep = "\n"
+				case j%40 == 39:
+					sep = ",\n"
+				}
+				fmt.Fprintf(buf, "%d%s", v, sep)
+			}
+			buf.WriteString("};\n")
+		}
+		charset := "upper"
+		if len(cc) > 0 && cc[0].Lowercase == 1 {
+			charset = "lower"
+		}
+		fmt.Fprintf(buf, "// META: 40 25 C64 %s\n", charset)
+	case "seq":
+		buf.Write(encodeSeq(cc))
+	case "basic":
+		if len(cc) != 1 {
+			return n, fmt.Errorf("-petscii-export basic supports 1 frame, not %d", len(cc))
+		}
+		buf.Write(encodeBasic(cc[0]))
+	case "pet":
+		for _, c := range cc {
+			buf.Write([]byte{40, 25, c.BorderColor, c.BackgroundColor, c.Lowercase})
+			buf.Write(c.Screen[:])
+			buf.Write(c.D800Color[:])
+		}
+	default:
+		return n, fmt.Errorf("unknown -petscii-export format %q, use petmate, marq, pet, seq or basic", format)
+	}
+	return buf.WriteTo(w)
+}
+
+// exportPETSCII writes cc in the -petscii-export format to w, instead of a .prg.
+func (c *Converter) exportPETSCII(w io.Writer, cc []PETSCIICharset) (n int64, err error) {
+	if len(cc) == 0 {
+		return n, fmt.Errorf("-petscii-export only supports petscii, not %s", c.FinalGraphicsType)
+	}
+	c.FinalGraphicsType = petsciiCharset
+	if !c.opt.Quiet {
+		fmt.Printf("export %d petscii frame(s) in %s format\n", len(cc), c.opt.PETSCIIExport)
+	}
+	return EncodePETSCIIDocument(w, c.opt.PETSCIIExport, cc)
+}
+
+// WritePETSCIIDocumentTo writes the frames of the petscii document to w,
+// as PETSCIICharset .prg for a single frame and as animation for multiple frames.
+func (c *Converter) WritePETSCIIDocumentTo(w io.Writer) (n int64, err error) {
+	cc := c.petsciiDocument
+	c.FinalGraphicsType = petsciiCharset
+	if !c.opt.Quiet {
+		fmt.Printf("read %d petscii frame(s) from %q, using the %s rom charset\n", len(cc), cc[0].SourceFilename, cc[0].ROMCharset)
+	}
+	if c.opt.PETSCIIExport != "" {
+		return c.exportPETSCII(w, cc)
+	}
+	if len(cc) == 1 {
+		if c.opt.Symbols {
+			c.Symbols = append(c.Symbols, cc[0].Symbols()...)
+		}
+		var wt io.WriterTo = cc[0]
+		if c.opt.Display && !c.opt.NoCrunch {
+			if wt, err = injectCrunch(wt, c.opt.Verbose); err != nil {
+				return n, fmt.Errorf("injectCrunch failed: %w", err)
+			}
+		}
+		return wt.WriteTo(w)
+	}
+	if c.opt.Display {
+		return c.writeAnimationDisplayerTo(w, nil, nil, nil, nil, nil, nil, nil, cc, nil)
+	}
+	c.Symbols = append(c.Symbols,
+		c64Symbol{"screen", 0x2800},
+		c64Symbol{"d800color", 0x2c00},
+		c64Symbol{"animation", 0x3000},
+		c64Symbol{"d020color", int(cc[0].BorderColor)},
+		c64Symbol{"d021color", int(cc[0].BackgroundColor)},
+	)
+	c.Symbols = append(c.Symbols, c.opt.romCharsetSymbols(cc[0].ROMCharset, cc[0].Lowercase)...)
+	return c.WritePETSCIICharsetAnimationTo(w, cc)
+}
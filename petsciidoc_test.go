@@ -0,0 +1,75 @@
+package png2prg
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPETSCIIDocumentRoundTrip(t *testing.T) {
+	t.Parallel()
+	cc := make([]PETSCIICharset, 2)
+	for i := range cc {
+		cc[i].BorderColor, cc[i].BackgroundColor, cc[i].Lowercase = byte(i+1), byte(i+6), 1
+		for j := range cc[i].Screen {
+			cc[i].Screen[j] = byte(j*7 + i)
+			cc[i].D800Color[j] = byte(j+i) & 0xf
+		}
+	}
+	type tc struct {
+		format string
+		name   string
+	}
+	testCases := []tc{
+		{"petmate", "test.petmate"},
+		{"marq", "test.c"},
+		{"pet", "test.pet"},
+	}
+	for _, c := range testCases {
+		buf := &bytes.Buffer{}
+		_, err := EncodePETSCIIDocument(buf, c.format, cc)
+		require.Nil(t, err, c.format)
+		got, err := decodePETSCIIDocument(Options{}, c.name, buf.Bytes())
+		require.Nil(t, err, c.format)
+		require.Len(t, got, len(cc), c.format)
+		for i := range cc {
+			assert.Equal(t, cc[i].Screen, got[i].Screen, c.format)
+			assert.Equal(t, cc[i].D800Color, got[i].D800Color, c.format)
+			assert.Equal(t, cc[i].BorderColor, got[i].BorderColor, c.format)
+			assert.Equal(t, cc[i].BackgroundColor, got[i].BackgroundColor, c.format)
+			assert.Equal(t, cc[i].Lowercase, got[i].Lowercase, c.format)
+			assert.Equal(t, "lowercase", got[i].ROMCharset, c.format)
+		}
+	}
+
+	_, err := decodePETSCIIDocument(Options{}, "test.prg", []byte{0x01, 0x08})
+	assert.ErrorIs(t, err, errNotPETSCIIDocument)
+	cc[0].ROMCharset = "swedish"
+	_, err = EncodePETSCIIDocument(&bytes.Buffer{}, "petmate", cc)
+	assert.NotNil(t, err)
+}
+
+func TestDestinationFilename(t *testing.T) {
+	t.Parallel()
+	type tc struct {
+		in   string
+		opt  Options
+		want string
+	}
+	testCases := []tc{
+		{"a.png", Options{}, "a.prg"},
+		{"dir/a.png", Options{PETSCIIExport: "petmate"}, "a.petmate"},
+		{"b.petmate", Options{PETSCIIExport: "petmate"}, "b_out.petmate"},
+		{"b.petmate", Options{PETSCIIExport: "pet"}, "b.pet"},
+		{"b.pet", Options{PETSCIIExport: "pet"}, "b_out.pet"},
+		{"b.c", Options{PETSCIIExport: "marq"}, "b_out.c"},
+		{"b.c", Options{PETSCIIExport: "marq", TargetDir: "out"}, filepath.Join("out", "b.c")},
+		{"b.c", Options{PETSCIIExport: "marq", OutFile: "x.c"}, "x.c"},
+	}
+	for _, c := range testCases {
+		assert.Equal(t, c.want, DestinationFilename(c.in, c.opt), c.in)
+	}
+}
@@ -0,0 +1,329 @@
+package png2prg
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"log"
+	"os"
+	"sort"
+)
+
+// quantizeImage returns im with all pixels replaced by the closest color of the first palette,
+// if im contains more than MaxColors colors. Otherwise im is returned as is.
+func quantizeImage(im image.Image) image.Image {
+	b := im.Bounds()
+	seen := map[colorKey]bool{}
+	for y := b.Min.Y; y < b.Max.Y && len(seen) <= MaxColors; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			seen[ColorKey(im.At(x, y))] = true
+		}
+	}
+	if len(seen) <= MaxColors {
+		return im
+	}
+	cache := map[colorKey]color.Color{}
+	out := image.NewRGBA(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			k := ColorKey(im.At(x, y))
+			col, ok := cache[k]
+			if !ok {
+				min := int(9e8)
+				for _, src := range paletteSources[0].Colors {
+					if d := src.Distance(im.At(x, y)); d < min {
+						col, min = src.Color, d
+					}
+				}
+				cache[k] = col
+			}
+			out.Set(x, y, col)
+		}
+	}
+	return out
+}
+
+// petsciifyCell contains the c64 colors of the pixels of a char.
+type petsciifyCell [64]C64Color
+
+// petsciifyResult is the best matching rom char and d800 color of a cell.
+type petsciifyResult struct {
+	char, color byte
+	err         int
+}
+
+// petsciifier finds the best matching rom chars for arbitrary cells, using the colors in the image.
+type petsciifier struct {
+	dist     [MaxColors][MaxColors]int
+	rgb      [MaxColors][3]int
+	colors   []C64Color
+	bg       C64Color
+	metric   string
+	glyphs   []charBytes
+	setbits  [MaxChars][]int
+	blockset [MaxChars][16]int
+}
+
+func newPetsciifier(p Palette, bg C64Color, metric string, glyphs []charBytes) *petsciifier {
+	ps := &petsciifier{bg: bg, metric: metric, glyphs: glyphs}
+	for _, col := range p.SortColors() {
+		ps.colors = append(ps.colors, col.C64Color)
+		r, g, b, _ := col.RGBA()
+		ps.rgb[col.C64Color] = [3]int{int(r & 0xff), int(g & 0xff), int(b & 0xff)}
+	}
+	for _, a := range ps.colors {
+		for _, b := range ps.colors {
+			ps.dist[a][b] = p.FromC64NoErr(a).Distance(p.FromC64NoErr(b))
+		}
+	}
+	for g, glyph := range glyphs {
+		for y := 0; y < 8; y++ {
+			for x := 0; x < 8; x++ {
+				if glyph[y]&(0x80>>x) != 0 {
+					ps.setbits[g] = append(ps.setbits[g], y*8+x)
+					ps.blockset[g][(y/2)*4+x/2]++
+				}
+			}
+		}
+	}
+	return ps
+}
+
+// best returns the rom char and d800 color with the lowest error for cell.
+func (ps *petsciifier) best(cell petsciifyCell) petsciifyResult {
+	res := petsciifyResult{err: -1}
+	if ps.metric == "structure" {
+		// compare the average rgb values of the 2x2 pixel blocks, so the density of the cell counts, not the exact pixel position.
+		var target [16][3]int
+		for i, col := range cell {
+			for c := 0; c < 3; c++ {
+				target[(i/16)*4+(i%8)/2][c] += ps.rgb[col][c]
+			}
+		}
+		for g := range ps.glyphs {
+			for _, fg := range ps.colors {
+				if fg == ps.bg && g != ' ' {
+					continue
+				}
+				err := 0
+				for block, n := range ps.blockset[g] {
+					for c := 0; c < 3; c++ {
+						d := target[block][c] - n*ps.rgb[fg][c] - (4-n)*ps.rgb[ps.bg][c]
+						if d < 0 {
+							d = -d
+						}
+						err += d
+					}
+				}
+				if res.err < 0 || err < res.err {
+					res = petsciifyResult{char: byte(g), color: byte(fg), err: err}
+				}
+			}
+		}
+		return res
+	}
+
+	base := 0
+	for _, col := range cell {
+		base += ps.dist[col][ps.bg]
+	}
+	for g := range ps.glyphs {
+		for _, fg := range ps.colors {
+			if fg == ps.bg && g != ' ' {
+				continue
+			}
+			err := base
+			for _, i := range ps.setbits[g] {
+				err += ps.dist[cell[i]][fg] - ps.dist[cell[i]][ps.bg]
+			}
+			if res.err < 0 || err < res.err {
+				res = petsciifyResult{char: byte(g), color: byte(fg), err: err}
+			}
+		}
+	}
+	return res
+}
+
+// Petsciify converts the img to PETSCIICharset, picking the best matching rom char and d800 color for each char.
+// Unlike PETSCIICharset, the image does not have to consist of rom chars, the result is lossy.
+// All rom charsets are tried, see -rom-charsets, the one with the lowest total error is used.
+func (img *sourceImage) Petsciify() (PETSCIICharset, error) {
+	c := PETSCIICharset{
+		SourceFilename: img.sourceFilename,
+		BorderColor:    byte(img.border.C64Color),
+		opt:            img.opt,
+	}
+	switch img.opt.PetsciifyMetric {
+	case "", "pixel", "structure":
+	default:
+		return c, fmt.Errorf("unknown -petsciify-metric %q, use pixel or structure", img.opt.PetsciifyMetric)
+	}
+	if img.width != FullScreenWidth || img.height != FullScreenHeight {
+		return c, fmt.Errorf("-petsciify requires a %dx%d image, not %dx%d", FullScreenWidth, FullScreenHeight, img.width, img.height)
+	}
+
+	count := make(map[C64Color]int, MaxColors)
+	cells := [FullScreenChars]petsciifyCell{}
+	for char := range cells {
+		x, y := xyFromChar(char)
+		for i := range cells[char] {
+			col, err := img.p.FromColor(img.At(x+i%8, y+i/8))
+			if err != nil {
+				return c, fmt.Errorf("img.p.FromColor in char %d (x=%d y=%d) failed: %w", char, x, y, err)
+			}
+			cells[char][i] = col.C64Color
+			count[col.C64Color]++
+		}
+	}
+	bg := C64Color(0)
+	if len(img.bpc) > 0 && img.bpc[0] != nil {
+		bg = img.bpc[0].C64Color
+	} else {
+		max := -1
+		for col, n := range count {
+			if n > max || (n == max && col < bg) {
+				bg, max = col, n
+			}
+		}
+	}
+	c.BackgroundColor = byte(bg)
+
+	var results [FullScreenChars]petsciifyResult
+	var glyphs []charBytes
+	total := -1
+	for _, rom := range img.opt.romCharsets() {
+		ps := newPetsciifier(img.p, bg, img.opt.PetsciifyMetric, rom.Chars)
+		var rr [FullScreenChars]petsciifyResult
+		sum := 0
+		for char := range cells {
+			rr[char] = ps.best(cells[char])
+			sum += rr[char].err
+		}
+		if img.opt.Verbose {
+			log.Printf("petsciify %s rom charset: total error %d", rom.Name, sum)
+		}
+		if total < 0 || sum < total {
+			total, results, glyphs = sum, rr, rom.Chars
+			c.ROMCharset, c.Lowercase = rom.Name, rom.Lowercase
+		}
+	}
+	for char, r := range results {
+		c.Screen[char], c.D800Color[char] = r.char, r.color
+	}
+
+	if !img.opt.Quiet {
+		img.petsciifyReport(c, glyphs, cells, results)
+	}
+	if img.opt.PetsciifyPreview != "" {
+		if err := img.writePetsciifyPreview(c, glyphs); err != nil {
+			return c, fmt.Errorf("writePetsciifyPreview failed: %w", err)
+		}
+	}
+	return c, nil
+}
+
+// petsciifyReport prints the quality of the petsciified image c, with the worst chars in verbose mode.
+func (img *sourceImage) petsciifyReport(c PETSCIICharset, glyphs []charBytes, cells [FullScreenChars]petsciifyCell, results [FullScreenChars]petsciifyResult) {
+	exact, pixels := 0, 0
+	wrong := [FullScreenChars]int{}
+	for char, cell := range cells {
+		glyph := glyphs[c.Screen[char]]
+		for i, col := range cell {
+			want := C64Color(c.BackgroundColor)
+			if glyph[i/8]&(0x80>>(i%8)) != 0 {
+				want = C64Color(c.D800Color[char])
+			}
+			if col != want {
+				wrong[char]++
+			}
+		}
+		if wrong[char] == 0 {
+			exact++
+		}
+		pixels += wrong[char]
+	}
+	fmt.Printf("petsciify: %d of %d chars match exactly, %d of %d pixels differ (%.1f%%), using the %s rom charset\n",
+		exact, FullScreenChars, pixels, FullScreenWidth*FullScreenHeight, float64(pixels)*100/float64(FullScreenWidth*FullScreenHeight), c.ROMCharset)
+	if !img.opt.Verbose {
+		return
+	}
+	worst := make([]int, FullScreenChars)
+	for i := range worst {
+		worst[i] = i
+	}
+	sort.SliceStable(worst, func(i, j int) bool {
+		return results[worst[i]].err > results[worst[j]].err
+	})
+	for _, char := range worst[:10] {
+		if wrong[char] == 0 {
+			break
+		}
+		x, y := xyFromChar(char)
+		log.Printf("char %d (x=%d y=%d): rom char %d color %d differs %d pixels, error %d", char, x, y, c.Screen[char], c.D800Color[char], wrong[char], results[char].err)
+	}
+}
+
+// writePetsciifyPreview renders c using the rom chars glyphs to png file img.opt.PetsciifyPreview.
+func (img *sourceImage) writePetsciifyPreview(c PETSCIICharset, glyphs []charBytes) error {
+	out := image.NewRGBA(image.Rect(0, 0, FullScreenWidth, FullScreenHeight))
+	bg := img.p.FromC64NoErr(C64Color(c.BackgroundColor))
+	for char := range c.Screen {
+		x, y := xyFromChar(char)
+		fg := img.p.FromC64NoErr(C64Color(c.D800Color[char]))
+		glyph := glyphs[c.Screen[char]]
+		for py := 0; py < 8; py++ {
+			for px := 0; px < 8; px++ {
+				col := bg.Color
+				if glyph[py]&(0x80>>px) != 0 {
+					col = fg.Color
+				}
+				out.Set(x+px, y+py, col)
+			}
+		}
+	}
+	f, err := os.Create(img.opt.PetsciifyPreview)
+	if err != nil {
+		return fmt.Errorf("os.Create %q failed: %w", img.opt.PetsciifyPreview, err)
+	}
+	defer f.Close()
+	if err = png.Encode(f, out); err != nil {
+		return fmt.Errorf("png.Encode %q failed: %w", img.opt.PetsciifyPreview, err)
+	}
+	if !img.opt.Quiet {
+		fmt.Printf("write petsciify preview to %q\n", img.opt.PetsciifyPreview)
+	}
+	return nil
+}
+
+// WritePetsciifyTo petsciifies the image and writes the resulting PETSCIICharset .prg to w.
+func (c *Converter) WritePetsciifyTo(w io.Writer) (n int64, err error) {
+	if len(c.images) != 1 {
+		return n, fmt.Errorf("-petsciify requires exactly 1 image, not %d", len(c.images))
+	}
+	img := &c.images[0]
+	if err = img.findBorderColor(); err != nil {
+		if img.opt.Verbose {
+			log.Printf("skipping: findBorderColor failed: %v", err)
+		}
+	}
+	ch, err := img.Petsciify()
+	if err != nil {
+		return n, fmt.Errorf("img.Petsciify %q failed: %w", img.sourceFilename, err)
+	}
+	img.graphicsType = petsciiCharset
+	if c.opt.PETSCIIExport != "" {
+		return c.exportPETSCII(w, []PETSCIICharset{ch})
+	}
+	if c.opt.Symbols {
+		c.Symbols = append(c.Symbols, ch.Symbols()...)
+	}
+	var wt io.WriterTo = ch
+	if c.opt.Display && !c.opt.NoCrunch {
+		if wt, err = injectCrunch(wt, c.opt.Verbose); err != nil {
+			return n, fmt.Errorf("injectCrunch failed: %w", err)
+		}
+	}
+	return wt.WriteTo(w)
+}
@@ -0,0 +1,220 @@
+package png2prg
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+)
+
+const (
+	petsciiReverseOn  = 0x12
+	petsciiReverseOff = 0x92
+	petsciiDelete     = 0x14
+	petsciiInsert     = 0x94
+	petsciiCursorLeft = 0x9d
+	petsciiClear      = 0x93
+	petsciiLowercase  = 0x0e
+	petsciiUppercase  = 0x8e
+	petsciiLockCase   = 0x08
+	petsciiQuote      = 0x22
+
+	basicStartAddress = 0x0801
+	basicTokenPrint   = 0x99
+	basicTokenPoke    = 0x97
+	basicTokenGoto    = 0x89
+	basicTokenChr     = 0xc7
+	basicMaxPayload   = 60
+)
+
+// petsciiColorCodes are the PETSCII control codes selecting c64 colors 0-15.
+var petsciiColorCodes = [MaxColors]byte{0x90, 0x05, 0x1c, 0x9f, 0x9c, 0x1e, 0x1f, 0x9e, 0x81, 0x95, 0x96, 0x97, 0x98, 0x99, 0x9a, 0x9b}
+
+// screencodeToPETSCII returns the printable PETSCII code of screencode sc and whether it needs reverse on.
+func screencodeToPETSCII(sc byte) (code byte, reverse bool) {
+	reverse = sc >= 0x80
+	sc &= 0x7f
+	switch {
+	case sc < 0x20:
+		return sc + 0x40, reverse
+	case sc < 0x40:
+		return sc, reverse
+	case sc < 0x60:
+		return sc + 0x80, reverse
+	}
+	return sc + 0x40, reverse
+}
+
+// petsciiPrinter converts screen cells to a PETSCII stream, only emitting color and reverse codes when they change.
+type petsciiPrinter struct {
+	buf     bytes.Buffer
+	color   int
+	reverse bool
+}
+
+func newPETSCIIPrinter() *petsciiPrinter {
+	return &petsciiPrinter{color: -1}
+}
+
+// state emits the color and reverse codes required to print cell char of c.
+func (p *petsciiPrinter) state(c PETSCIICharset, char int) {
+	code, reverse := screencodeToPETSCII(c.Screen[char])
+	col := int(c.D800Color[char] & 0xf)
+	// the color of a space is invisible
+	if col != p.color && !(code == ' ' && !reverse) {
+		p.buf.WriteByte(petsciiColorCodes[col])
+		p.color = col
+	}
+	if reverse != p.reverse {
+		if reverse {
+			p.buf.WriteByte(petsciiReverseOn)
+		} else {
+			p.buf.WriteByte(petsciiReverseOff)
+		}
+		p.reverse = reverse
+	}
+}
+
+// char prints the screencode of cell char of c.
+func (p *petsciiPrinter) char(c PETSCIICharset, char int) {
+	code, _ := screencodeToPETSCII(c.Screen[char])
+	p.buf.WriteByte(code)
+}
+
+// cells prints cells 0 up to n of c, including color and reverse codes.
+// A printed quote enables quote mode, which is disabled by printing a 2nd quote and deleting it.
+func (p *petsciiPrinter) cells(c PETSCIICharset, n int) {
+	for char := 0; char < n; char++ {
+		p.state(c, char)
+		p.char(c, char)
+		if code, _ := screencodeToPETSCII(c.Screen[char]); code == petsciiQuote {
+			p.buf.Write([]byte{petsciiQuote, petsciiDelete})
+		}
+	}
+}
+
+// header prints the charset selection and clears the screen.
+func (p *petsciiPrinter) header(c PETSCIICharset) {
+	cs := byte(petsciiUppercase)
+	if c.Lowercase == 1 {
+		cs = petsciiLowercase
+	}
+	p.buf.Write([]byte{cs, petsciiLockCase, petsciiClear})
+	p.color, p.reverse = -1, false
+}
+
+// isQuote returns true if cell char of c prints as quote.
+func isQuote(c PETSCIICharset, char int) bool {
+	code, _ := screencodeToPETSCII(c.Screen[char])
+	return code == petsciiQuote
+}
+
+// encodeSeq returns the frames cc as PETSCII .seq stream.
+// Printing the bottom right char would scroll the screen, so the last 2 chars are printed
+// in reverse order, using insert to move the last char into place.
+// The .seq does not contain the border and background colors.
+func encodeSeq(cc []PETSCIICharset) []byte {
+	p := newPETSCIIPrinter()
+	for i, c := range cc {
+		for _, char := range []int{FullScreenChars - 2, FullScreenChars - 1} {
+			if isQuote(c, char) {
+				// quote mode would print the following control codes as chars.
+				c.Screen[char] = ' '
+				if !c.opt.Quiet {
+					fmt.Printf("frame %d: quote in char %d of the .seq is replaced by a space\n", i, char)
+				}
+			}
+		}
+		p.header(c)
+		p.cells(c, FullScreenChars-2)
+		p.state(c, FullScreenChars-1)
+		p.char(c, FullScreenChars-1)
+		p.state(c, FullScreenChars-2)
+		p.buf.Write([]byte{petsciiCursorLeft, petsciiInsert})
+		p.char(c, FullScreenChars-2)
+	}
+	return p.buf.Bytes()
+}
+
+// basicLine is a tokenized BASIC line without the link pointer.
+type basicLine struct {
+	number int
+	tokens []byte
+}
+
+// encodeBasic returns c as tokenized BASIC .prg that prints the picture.
+// The last 2 chars are poked, so the screen does not scroll.
+func encodeBasic(c PETSCIICharset) []byte {
+	var lines []basicLine
+	add := func(tokens []byte) {
+		lines = append(lines, basicLine{number: (len(lines) + 1) * 10, tokens: tokens})
+	}
+	num := func(v int) []byte {
+		return []byte(strconv.Itoa(v))
+	}
+	chr := func(v int) []byte {
+		return append(append([]byte{basicTokenChr, '('}, num(v)...), ')')
+	}
+	poke := func(addr, v int) []byte {
+		return append(append(append([]byte{basicTokenPoke}, num(addr)...), ','), num(v)...)
+	}
+
+	cs := petsciiUppercase
+	if c.Lowercase == 1 {
+		cs = petsciiLowercase
+	}
+	line := poke(0xd020, int(c.BorderColor))
+	line = append(append(line, ':'), poke(0xd021, int(c.BackgroundColor))...)
+	line = append(append(line, ':', basicTokenPrint), chr(petsciiClear)...)
+	line = append(append(line, chr(cs)...), chr(petsciiLockCase)...)
+	add(append(line, ';'))
+
+	p := newPETSCIIPrinter()
+	p.cells(c, FullScreenChars-2)
+	line, inString, payload := []byte{basicTokenPrint}, false, 0
+	for _, b := range p.buf.Bytes() {
+		if b == petsciiQuote {
+			if inString {
+				line, inString = append(line, '"'), false
+			}
+			line = append(line, chr(petsciiQuote)...)
+		} else {
+			if !inString {
+				line, inString = append(line, '"'), true
+			}
+			line = append(line, b)
+		}
+		if payload++; payload >= basicMaxPayload {
+			if inString {
+				line = append(line, '"')
+			}
+			add(append(line, ';'))
+			line, inString, payload = []byte{basicTokenPrint}, false, 0
+		}
+	}
+	if payload > 0 {
+		if inString {
+			line = append(line, '"')
+		}
+		add(append(line, ';'))
+	}
+
+	line = []byte{}
+	for _, char := range []int{FullScreenChars - 2, FullScreenChars - 1} {
+		if len(line) > 0 {
+			line = append(line, ':')
+		}
+		line = append(append(append(line, poke(0x0400+char, int(c.Screen[char]))...), ':'), poke(0xd800+char, int(c.D800Color[char]&0xf))...)
+	}
+	add(line)
+	end := (len(lines) + 1) * 10
+	add(append([]byte{basicTokenGoto}, num(end)...))
+
+	buf := []byte{basicStartAddress & 0xff, basicStartAddress >> 8}
+	addr := basicStartAddress
+	for _, l := range lines {
+		addr += 4 + len(l.tokens) + 1
+		buf = append(buf, byte(addr), byte(addr>>8), byte(l.number), byte(l.number>>8))
+		buf = append(append(buf, l.tokens...), 0)
+	}
+	return append(buf, 0, 0)
+}
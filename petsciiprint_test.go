@@ -0,0 +1,100 @@
+package png2prg
+
+import (
+	"bytes"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScreencodeToPETSCII(t *testing.T) {
+	t.Parallel()
+	type tc struct {
+		sc      byte
+		code    byte
+		reverse bool
+	}
+	testCases := []tc{
+		{0x00, 0x40, false}, // @
+		{0x01, 0x41, false}, // A
+		{0x20, 0x20, false}, // space
+		{0x22, 0x22, false}, // quote
+		{0x30, 0x30, false}, // 0
+		{0x40, 0xc0, false},
+		{0x60, 0xa0, false},
+		{0x81, 0x41, true},
+		{0xa0, 0x20, true},
+	}
+	for _, c := range testCases {
+		code, reverse := screencodeToPETSCII(c.sc)
+		assert.Equal(t, c.code, code, "screencode $%02x", c.sc)
+		assert.Equal(t, c.reverse, reverse, "screencode $%02x", c.sc)
+	}
+}
+
+// testPETSCIIFrame returns a frame of spaces, with a reversed red A in the top left corner.
+func testPETSCIIFrame() PETSCIICharset {
+	c := PETSCIICharset{BorderColor: 6, BackgroundColor: 14, opt: Options{Quiet: true}}
+	for i := range c.Screen {
+		c.Screen[i] = 0x20
+	}
+	c.Screen[0], c.D800Color[0] = 0x81, 2
+	return c
+}
+
+func TestEncodeSeq(t *testing.T) {
+	t.Parallel()
+	c := testPETSCIIFrame()
+	c.Screen[FullScreenChars-1], c.D800Color[FullScreenChars-1] = 0x02, 1
+	seq := encodeSeq([]PETSCIICharset{c})
+	want := []byte{petsciiUppercase, petsciiLockCase, petsciiClear, 0x1c, petsciiReverseOn, 0x41, petsciiReverseOff}
+	require.True(t, bytes.HasPrefix(seq, want))
+	seq = seq[len(want):]
+	assert.Equal(t, bytes.Repeat([]byte{' '}, FullScreenChars-3), seq[:FullScreenChars-3])
+	// the last char is printed first, then the one before it is inserted.
+	assert.Equal(t, []byte{0x05, 0x42, petsciiCursorLeft, petsciiInsert, ' '}, seq[FullScreenChars-3:])
+
+	// a quote in the last 2 chars would enable quote mode.
+	c.Screen[FullScreenChars-2], c.Lowercase = 0x22, 1
+	seq = encodeSeq([]PETSCIICharset{c})
+	assert.Equal(t, byte(petsciiLowercase), seq[0])
+	assert.NotContains(t, string(seq), `"`)
+}
+
+func TestEncodeBasic(t *testing.T) {
+	t.Parallel()
+	c := testPETSCIIFrame()
+	c.Screen[1] = 0x22
+	prg := encodeBasic(c)
+	require.Equal(t, []byte{0x01, 0x08}, prg[:2])
+
+	// follow the line links and collect the tokens of each line.
+	var numbers []int
+	var lines [][]byte
+	for addr := basicStartAddress; ; {
+		i := addr - basicStartAddress + 2
+		next := int(prg[i]) | int(prg[i+1])<<8
+		if next == 0 {
+			require.Equal(t, len(prg), i+2)
+			break
+		}
+		end := next - basicStartAddress + 2
+		require.Equal(t, byte(0), prg[end-1])
+		numbers = append(numbers, int(prg[i+2])|int(prg[i+3])<<8)
+		lines = append(lines, prg[i+4:end-1])
+		addr = next
+	}
+	require.GreaterOrEqual(t, len(lines), 4)
+	for i, n := range numbers {
+		assert.Equal(t, (i+1)*10, n)
+	}
+	assert.True(t, bytes.HasPrefix(lines[0], []byte{basicTokenPoke, '5', '3', '2', '8', '0', ',', '6', ':'}))
+	// the quote is printed with chr$(34) outside of the string, twice to leave quote mode, then deleted.
+	chr34 := string([]byte{basicTokenChr}) + "(34)"
+	assert.Contains(t, string(lines[1]), `"`+chr34+chr34+`"`+string([]byte{petsciiDelete}))
+	// the last 2 chars are poked into screen and color ram.
+	assert.True(t, bytes.HasPrefix(lines[len(lines)-2], append([]byte{basicTokenPoke}, "2022,32:"...)))
+	assert.Equal(t, append([]byte{basicTokenGoto}, strconv.Itoa(numbers[len(numbers)-1])...), lines[len(lines)-1])
+}
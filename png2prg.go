@@ -17,6 +17,7 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
@@ -30,6 +31,7 @@ const (
 	MaxChars             = 256
 	MaxECMChars          = 64
 	FullScreenChars      = 1000
+	FullScreenRows       = 25
 	FullScreenWidth      = 320
 	FullScreenHeight     = 200
 	ViceFullScreenWidth  = 384
@@ -42,6 +44,10 @@ const (
 	BitmapColorRAMAddress   = 0x4328
 	CharsetScreenRAMAddress = 0x2800
 	CharsetColorRAMAddress  = 0x2c00
+	CharsetRowD022Address   = 0x3000
+	CharsetRowD023Address   = 0x3020
+	CharsetBandAddress      = 0x3000
+	MaxCharsetBands         = 3
 
 	DisplayerSettingsStart = 0x081a
 	displayerJumpTo        = "$0829"
@@ -82,10 +88,44 @@ type Options struct {
 	WaitSeconds          int
 	ForceXOffset         int
 	ForceYOffset         int
+	RowColors            bool
+	CharsetSplits        string
+	SplitScreen          string
+	Blended              bool
+	CharsetFile          string
+	CharsetReserve       string
+	SharedCharset        bool
+	MaxUniqueChars       int
+	MaxUniqueCharsDiff   string
+	CharOrder            string
+	Font                 string
+	FontMap              string
+	Petsciify            bool
+	PetsciifyMetric      string
+	PetsciifyPreview     string
+	PETSCIIExport        string
+	ROMCharsets          string
+	SpriteMargin         int
+	SpriteSpacing        int
+	SpriteColumnMajor    bool
+	SpriteRect           string
+	SpriteObjects        string
+	SpriteExpand         string
+	SpriteOverlay        bool
+	SpriteDedup          bool
+	SpriteMirror         bool
+	SpriteTrim           bool
+	SpriteAddress        string
+	SpriteNames          string
 	CurrentGraphicsType  GraphicsType
 
 	Trd                           bool // has side effect of enforcing screenram colors in level area
 	disableRepeatingBitpairColors bool // koala/hires animations should not want this optimization
+	charsetFile                   []charBytes
+	romCharsetList                []ROMCharset
+	spriteAddr                    int
+	spriteNames                   []string
+	keepSpriteColors              bool // the multicolor layer of layered sprites always stores the individual colors
 }
 
 func (o Options) NoFadeByte() byte {
@@ -117,6 +157,10 @@ const (
 	mixedCharset
 	petsciiCharset
 	ecmCharset
+	splitScreen
+	ecmPETSCIICharset
+	mixedSprites
+	layeredSprites
 )
 
 func StringToGraphicsType(s string) GraphicsType {
@@ -133,6 +177,10 @@ func StringToGraphicsType(s string) GraphicsType {
 		return singleColorSprites
 	case "mcsprites":
 		return multiColorSprites
+	case "mixedsprites":
+		return mixedSprites
+	case "layeredsprites":
+		return layeredSprites
 	case "mcibitmap":
 		return multiColorInterlaceBitmap
 	case "mixedcharset":
@@ -141,6 +189,8 @@ func StringToGraphicsType(s string) GraphicsType {
 		return petsciiCharset
 	case "ecm":
 		return ecmCharset
+	case "ecmpetscii":
+		return ecmPETSCIICharset
 	}
 	return unknownGraphicsType
 }
@@ -167,6 +217,14 @@ func (t GraphicsType) String() string {
 		return "petscii"
 	case ecmCharset:
 		return "ecm"
+	case splitScreen:
+		return "split screen"
+	case ecmPETSCIICharset:
+		return "ecm petscii"
+	case mixedSprites:
+		return "mixed sprites"
+	case layeredSprites:
+		return "layered sprites"
 	default:
 		return "unknown"
 	}
@@ -182,6 +240,7 @@ type sourceImage struct {
 	width           int
 	height          int
 	graphicsType    GraphicsType
+	expand          spriteExpansion
 	p               Palette
 	bpc             BPColors
 	bpc2            BPColors
@@ -231,6 +290,7 @@ type Koala struct {
 	D800Color       [1000]byte
 	BackgroundColor byte
 	BorderColor     byte
+	Overlay         *SpriteOverlay // see -sprite-overlay
 	opt             Options
 }
 
@@ -260,13 +320,13 @@ type Symbolser interface {
 }
 
 func (img Koala) Symbols() []c64Symbol {
-	return []c64Symbol{
+	return append([]c64Symbol{
 		{"bitmap", BitmapAddress},
 		{"screenram", BitmapScreenRAMAddress},
 		{"colorram", BitmapColorRAMAddress},
 		{"d020color", int(img.BorderColor)},
 		{"d021color", int(img.BackgroundColor)},
-	}
+	}, img.Overlay.Symbols()...)
 }
 
 type Hires struct {
@@ -274,15 +334,16 @@ type Hires struct {
 	Bitmap         [8000]byte
 	ScreenColor    [1000]byte
 	BorderColor    byte
+	Overlay        *SpriteOverlay // see -sprite-overlay
 	opt            Options
 }
 
 func (img Hires) Symbols() []c64Symbol {
-	return []c64Symbol{
+	return append([]c64Symbol{
 		{"bitmap", BitmapAddress},
 		{"screenram", BitmapScreenRAMAddress},
 		{"d020color", int(img.BorderColor)},
-	}
+	}, img.Overlay.Symbols()...)
 }
 
 type MultiColorCharset struct {
@@ -295,11 +356,14 @@ type MultiColorCharset struct {
 	BackgroundColor byte
 	D022Color       byte
 	D023Color       byte
+	RowD022Color    [FullScreenRows]byte
+	RowD023Color    [FullScreenRows]byte
+	Bands           []CharsetBand
 	opt             Options
 }
 
 func (img MultiColorCharset) Symbols() []c64Symbol {
-	return []c64Symbol{
+	s := []c64Symbol{
 		{"bitmap", BitmapAddress},
 		{"screenram", CharsetScreenRAMAddress},
 		{"charcolor", int(img.CharColor)},
@@ -308,6 +372,10 @@ func (img MultiColorCharset) Symbols() []c64Symbol {
 		{"d022color", int(img.D022Color)},
 		{"d023color", int(img.D023Color)},
 	}
+	if img.opt.RowColors {
+		s = append(s, c64Symbol{"rowd022colors", CharsetRowD022Address}, c64Symbol{"rowd023colors", CharsetRowD023Address})
+	}
+	return append(s, charsetBandSymbols(img.Bands)...)
 }
 
 func (c MultiColorCharset) UsedChars() int {
@@ -347,6 +415,30 @@ func (c MultiColorCharset) CharBytes() (cbs []charBytes) {
 	return cbs
 }
 
+// A CharsetBand is an additional charset, used from char row Row onwards.
+type CharsetBand struct {
+	Row    int
+	Bitmap [0x800]byte
+}
+
+// charsetBandSymbols returns the symbols of the additional charsets and their first char rows.
+func charsetBandSymbols(bands []CharsetBand) (s []c64Symbol) {
+	for i, b := range bands {
+		s = append(s, c64Symbol{fmt.Sprintf("charset%d", i+1), CharsetBandAddress + i*0x800}, c64Symbol{fmt.Sprintf("charset%drow", i+1), b.Row})
+	}
+	return s
+}
+
+// writeCharsetBands writes the additional charsets to link.
+func writeCharsetBands(link *Linker, bands []CharsetBand) error {
+	for i := range bands {
+		if _, err := link.CursorWrite(Word(CharsetBandAddress+i*0x800), bands[i].Bitmap[:]); err != nil {
+			return fmt.Errorf("link.CursorWrite charset band %d failed: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
 type SingleColorCharset struct {
 	SourceFilename  string
 	Bitmap          [0x800]byte
@@ -354,17 +446,18 @@ type SingleColorCharset struct {
 	D800Color       [1000]byte
 	BackgroundColor byte
 	BorderColor     byte
+	Bands           []CharsetBand
 	opt             Options
 }
 
 func (img SingleColorCharset) Symbols() []c64Symbol {
-	return []c64Symbol{
+	return append([]c64Symbol{
 		{"bitmap", BitmapAddress},
 		{"screenram", CharsetScreenRAMAddress},
 		{"colorram", CharsetColorRAMAddress},
 		{"d020color", int(img.BorderColor)},
 		{"d021color", int(img.BackgroundColor)},
-	}
+	}, charsetBandSymbols(img.Bands)...)
 }
 
 func (c SingleColorCharset) UsedChars() int {
@@ -413,11 +506,14 @@ type MixedCharset struct {
 	BackgroundColor byte
 	D022Color       byte
 	D023Color       byte
+	RowD022Color    [FullScreenRows]byte
+	RowD023Color    [FullScreenRows]byte
+	Bands           []CharsetBand
 	opt             Options
 }
 
 func (img MixedCharset) Symbols() []c64Symbol {
-	return []c64Symbol{
+	s := []c64Symbol{
 		{"bitmap", BitmapAddress},
 		{"screenram", CharsetScreenRAMAddress},
 		{"colorram", CharsetColorRAMAddress},
@@ -426,6 +522,10 @@ func (img MixedCharset) Symbols() []c64Symbol {
 		{"d022color", int(img.D022Color)},
 		{"d023color", int(img.D023Color)},
 	}
+	if img.opt.RowColors {
+		s = append(s, c64Symbol{"rowd022colors", CharsetRowD022Address}, c64Symbol{"rowd023colors", CharsetRowD023Address})
+	}
+	return append(s, charsetBandSymbols(img.Bands)...)
 }
 
 func (c MixedCharset) UsedChars() int {
@@ -467,7 +567,8 @@ func (c MixedCharset) CharBytes() (cbs []charBytes) {
 
 type PETSCIICharset struct {
 	SourceFilename  string
-	Lowercase       byte // 0 = uppercase, 1 = lowercase
+	ROMCharset      string // name of the rom charset, see -rom-charsets
+	Lowercase       byte   // 0 = uppercase, 1 = lowercase, as used by the displayers
 	Screen          [1000]byte
 	D800Color       [1000]byte
 	BackgroundColor byte
@@ -476,12 +577,12 @@ type PETSCIICharset struct {
 }
 
 func (img PETSCIICharset) Symbols() []c64Symbol {
-	return []c64Symbol{
+	return append([]c64Symbol{
 		{"screenram", CharsetScreenRAMAddress},
 		{"colorram", CharsetColorRAMAddress},
 		{"d020color", int(img.BorderColor)},
 		{"d021color", int(img.BackgroundColor)},
-	}
+	}, img.opt.romCharsetSymbols(img.ROMCharset, img.Lowercase)...)
 }
 
 type ECMCharset struct {
@@ -517,17 +618,25 @@ type SingleColorSprites struct {
 	BackgroundColor byte
 	Columns         byte
 	Rows            byte
+	ObjectWidth     byte
+	ObjectHeight    byte
+	Colors          []byte // individual color of each sprite
+	Index           []byte // stored sprite of each sprite, see -sprite-dedup
+	ExpandX         bool   // see -sprite-expand
+	ExpandY         bool
 	opt             Options
 }
 
 func (img SingleColorSprites) Symbols() []c64Symbol {
-	return []c64Symbol{
-		{"bitmap", BitmapAddress},
+	syms := []c64Symbol{
+		{"bitmap", img.opt.spriteAddress()},
 		{"columns", int(img.Columns)},
 		{"rows", int(img.Rows)},
 		{"spritecolor", int(img.SpriteColor)},
 		{"d021color", int(img.BackgroundColor)},
 	}
+	syms = append(syms, spriteExpansionSymbols(img.ExpandX, img.ExpandY)...)
+	return append(syms, spriteTableSymbols(img.opt, img.Bitmap, img.Colors, img.Index, img.ObjectWidth, img.ObjectHeight)...)
 }
 
 type MultiColorSprites struct {
@@ -539,12 +648,19 @@ type MultiColorSprites struct {
 	D026Color       byte
 	Columns         byte
 	Rows            byte
+	ObjectWidth     byte
+	ObjectHeight    byte
+	Colors          []byte // individual color of each sprite
+	Index           []byte // stored sprite of each sprite, see -sprite-dedup
+	ExpandX         bool   // see -sprite-expand
+	ExpandY         bool
+	Hires           []bool // singlecolor sprites in mixed sprites
 	opt             Options
 }
 
 func (img MultiColorSprites) Symbols() []c64Symbol {
-	return []c64Symbol{
-		{"bitmap", BitmapAddress},
+	syms := []c64Symbol{
+		{"bitmap", img.opt.spriteAddress()},
 		{"columns", int(img.Columns)},
 		{"rows", int(img.Rows)},
 		{"spritecolor", int(img.SpriteColor)},
@@ -552,6 +668,8 @@ func (img MultiColorSprites) Symbols() []c64Symbol {
 		{"d025color", int(img.D025Color)},
 		{"d026color", int(img.D026Color)},
 	}
+	syms = append(syms, spriteExpansionSymbols(img.ExpandX, img.ExpandY)...)
+	return append(syms, spriteTableSymbols(img.opt, img.Bitmap, img.Colors, img.Index, img.ObjectWidth, img.ObjectHeight)...)
 }
 
 var displayers = make(map[GraphicsType][]byte, 0)
@@ -592,6 +710,9 @@ var koalaDisplayAnim []byte
 //go:embed "display_hires_anim.prg"
 var hiresDisplayAnim []byte
 
+//go:embed "display_sprites_anim.prg"
+var spritesDisplayAnim []byte
+
 //go:embed "display_mci_bitmap.prg"
 var mciBitmapDisplay []byte
 
@@ -633,6 +754,11 @@ func (t GraphicsType) newHeader() []byte {
 	return bin
 }
 
+// isSprites returns true if t is one of the sprite graphics types.
+func (t GraphicsType) isSprites() bool {
+	return t == singleColorSprites || t == multiColorSprites || t == mixedSprites || t == layeredSprites
+}
+
 // A Converter implements the io.WriterTo interface.
 type Converter struct {
 	opt               Options
@@ -640,6 +766,10 @@ type Converter struct {
 	AnimItems         []AnimItem
 	Symbols           []c64Symbol
 	FinalGraphicsType GraphicsType
+
+	font            *Font
+	fontSheet       image.Image
+	petsciiDocument []PETSCIICharset
 }
 
 // New processes the input images or anim.csv and returns the Converter.
@@ -655,12 +785,103 @@ func New(opt Options, pngs ...io.Reader) (*Converter, error) {
 	if opt.GraphicsMode != "" && opt.CurrentGraphicsType == unknownGraphicsType {
 		opt.CurrentGraphicsType = StringToGraphicsType(opt.GraphicsMode)
 	}
+	if opt.MaxUniqueChars < 0 || opt.MaxUniqueChars > MaxChars {
+		return nil, fmt.Errorf("-max-chars %d is not correct, only values 1-%d are allowed", opt.MaxUniqueChars, MaxChars)
+	}
+	if opt.PETSCIIExport != "" && !isPETSCIIExportFormat(opt.PETSCIIExport) {
+		return nil, fmt.Errorf("unknown -petscii-export format %q, use petmate, marq, pet, seq or basic", opt.PETSCIIExport)
+	}
+	if err := validateCharOrder(opt); err != nil {
+		return nil, fmt.Errorf("validateCharOrder failed: %w", err)
+	}
+	if opt.CharsetFile != "" {
+		if opt.NoPackChars {
+			return nil, fmt.Errorf("-charset can not be combined with -no-pack")
+		}
+		if isCharsetImage(opt.CharsetFile) && (opt.CurrentGraphicsType == multiColorCharset || opt.CurrentGraphicsType == mixedCharset) {
+			return nil, fmt.Errorf("-charset image %q can not be used for -mode %s, multicolor chars require a .bin or .prg charset", opt.CharsetFile, opt.GraphicsMode)
+		}
+		var err error
+		if opt.charsetFile, err = LoadCharsetFile(opt.CharsetFile); err != nil {
+			return nil, fmt.Errorf("LoadCharsetFile failed: %w", err)
+		}
+		if opt.CharsetReserve != "" {
+			if _, err = parseCharRanges(opt.CharsetReserve); err != nil {
+				return nil, fmt.Errorf("parseCharRanges failed: %w", err)
+			}
+		}
+	}
+	if opt.ROMCharsets != "" {
+		var err error
+		if opt.romCharsetList, err = LoadROMCharsets(opt.ROMCharsets); err != nil {
+			return nil, fmt.Errorf("LoadROMCharsets failed: %w", err)
+		}
+	}
+	if _, err := parseSpriteSheet(opt); err != nil {
+		return nil, fmt.Errorf("parseSpriteSheet failed: %w", err)
+	}
+	if opt.SpriteOverlay && opt.GraphicsMode != "" && opt.CurrentGraphicsType != multiColorBitmap && opt.CurrentGraphicsType != singleColorBitmap {
+		return nil, fmt.Errorf("-sprite-overlay only supports -mode koala and hires, not %s", opt.GraphicsMode)
+	}
+	if e, err := parseSpriteExpansion(opt); err != nil {
+		return nil, fmt.Errorf("parseSpriteExpansion failed: %w", err)
+	} else if (e.x || e.y) && opt.GraphicsMode != "" && !opt.CurrentGraphicsType.isSprites() {
+		return nil, fmt.Errorf("-sprite-expand %s can not be combined with -mode %s", e, opt.GraphicsMode)
+	}
+	if opt.SpriteAddress != "" || opt.SpriteNames != "" {
+		if opt.Display {
+			return nil, fmt.Errorf("-sprite-address and -sprite-names have no displayer support")
+		}
+		if opt.GraphicsMode != "" && !opt.CurrentGraphicsType.isSprites() {
+			return nil, fmt.Errorf("-sprite-address and -sprite-names can not be combined with -mode %s", opt.GraphicsMode)
+		}
+	}
+	if opt.SpriteAddress != "" {
+		var err error
+		if opt.spriteAddr, err = parseSpriteAddress(opt.SpriteAddress); err != nil {
+			return nil, fmt.Errorf("parseSpriteAddress failed: %w", err)
+		}
+	}
+	if opt.SpriteNames != "" {
+		var err error
+		if opt.spriteNames, err = LoadSpriteNames(opt.SpriteNames); err != nil {
+			return nil, fmt.Errorf("LoadSpriteNames failed: %w", err)
+		}
+	}
 	c := &Converter{opt: opt}
+	if opt.Font != "" {
+		if len(pngs) != 1 {
+			return nil, fmt.Errorf("-font requires exactly 1 image, not %d", len(pngs))
+		}
+		path := "png2prg_00"
+		if n, isNamer := pngs[0].(interface{ Name() string }); isNamer {
+			path = n.Name()
+		}
+		var err error
+		if c.fontSheet, _, err = image.Decode(pngs[0]); err != nil {
+			return nil, fmt.Errorf("image.Decode %q failed: %w", path, err)
+		}
+		if c.font, err = NewFont(opt, path, c.fontSheet); err != nil {
+			return nil, fmt.Errorf("NewFont %q failed: %w", path, err)
+		}
+		return c, nil
+	}
 	if len(pngs) == 1 {
+		path := "png2prg_00"
+		if n, isNamer := pngs[0].(interface{ Name() string }); isNamer {
+			path = n.Name()
+		}
 		bin, err := io.ReadAll(pngs[0])
 		if err != nil {
 			return nil, fmt.Errorf("io.ReadAll failed: %w", err)
 		}
+		c.petsciiDocument, err = decodePETSCIIDocument(opt, path, bin)
+		switch {
+		case err == nil:
+			return c, nil
+		case !errors.Is(err, errNotPETSCIIDocument):
+			return nil, fmt.Errorf("decodePETSCIIDocument failed: %w", err)
+		}
 		c.AnimItems, err = ExtractAnimationCSV(bytes.NewReader(bin))
 		switch {
 		case err == nil:
@@ -679,6 +900,44 @@ func New(opt Options, pngs ...io.Reader) (*Converter, error) {
 			pngs[0] = bytes.NewReader(bin)
 		}
 	}
+	if len(pngs) == 1 && (opt.Blended || (opt.Interlace && opt.CurrentGraphicsType == singleColorBitmap)) {
+		// blended colors are not shifted, both frames are displayed at the same position
+		c.opt.Interlace = true
+		c.opt.D016Offset = 0
+		im, _, err := image.Decode(pngs[0])
+		if err != nil {
+			return nil, fmt.Errorf("image.Decode failed: %w", err)
+		}
+		rgba0, rgba1, err := SplitBlendedImage(opt, im)
+		if err != nil {
+			return nil, fmt.Errorf("SplitBlendedImage failed: %w", err)
+		}
+		for index, rgba := range []*image.RGBA{rgba0, rgba1} {
+			img, err := NewSourceImage(opt, index, rgba)
+			if err != nil {
+				return nil, fmt.Errorf("NewSourceImage failed: %w", err)
+			}
+			c.images = append(c.images, img)
+		}
+		return c, nil
+	}
+	if len(pngs) == 1 && opt.Petsciify {
+		path := "png2prg_00"
+		if n, isNamer := pngs[0].(interface{ Name() string }); isNamer {
+			path = n.Name()
+		}
+		im, _, err := image.Decode(pngs[0])
+		if err != nil {
+			return nil, fmt.Errorf("image.Decode %q failed: %w", path, err)
+		}
+		img, err := NewSourceImage(opt, 0, quantizeImage(im))
+		if err != nil {
+			return nil, fmt.Errorf("NewSourceImage %q failed: %w", path, err)
+		}
+		img.sourceFilename = path
+		c.images = append(c.images, img)
+		return c, nil
+	}
 	for index, ir := range pngs {
 		ii, err := NewSourceImages(opt, index, ir)
 		if err != nil {
@@ -701,6 +960,18 @@ func NewSourceImages(opt Options, index int, r io.Reader) (imgs []sourceImage, e
 	if err != nil {
 		return nil, fmt.Errorf("io.ReadAll %q failed: %w", path, err)
 	}
+	sheet, err := parseSpriteSheet(opt)
+	if err != nil {
+		return nil, fmt.Errorf("parseSpriteSheet failed: %w", err)
+	}
+	expand, err := parseSpriteExpansion(opt)
+	if err != nil {
+		return nil, fmt.Errorf("parseSpriteExpansion failed: %w", err)
+	}
+	if sheet != nil && expand.auto {
+		// the cells of a sheet are laid out in native sprite size, unless -sprite-expand is set.
+		return nil, fmt.Errorf("-sprite-expand auto is not supported for sprite sheets, use x, y or xy")
+	}
 
 	// try gif first
 	if g, err := gif.DecodeAll(bytes.NewReader(bin)); err == nil {
@@ -716,6 +987,16 @@ func NewSourceImages(opt Options, index int, r io.Reader) (imgs []sourceImage, e
 				opt:            opt,
 				image:          rawImage,
 			}
+			if sheet != nil {
+				if img.image, err = sheet.layout(rawImage); err != nil {
+					return nil, fmt.Errorf("sheet.layout %q frame %d failed: %w", path, i, err)
+				}
+			}
+			if img.image, img.expand, err = expand.apply(opt, img.image); err != nil {
+				return nil, fmt.Errorf("expand.apply %q frame %d failed: %w", path, i, err)
+			}
+			// all frames use the expansion of the first frame.
+			expand = img.expand
 			switch {
 			case i == 0:
 				if err = img.checkBounds(); err != nil {
@@ -745,6 +1026,14 @@ func NewSourceImages(opt Options, index int, r io.Reader) (imgs []sourceImage, e
 	if img.image, _, err = image.Decode(bytes.NewReader(bin)); err != nil {
 		return nil, fmt.Errorf("image.Decode failed: %w", err)
 	}
+	if sheet != nil {
+		if img.image, err = sheet.layout(img.image); err != nil {
+			return nil, fmt.Errorf("sheet.layout %q failed: %w", path, err)
+		}
+	}
+	if img.image, img.expand, err = expand.apply(opt, img.image); err != nil {
+		return nil, fmt.Errorf("expand.apply %q failed: %w", path, err)
+	}
 	if err = img.checkBounds(); err != nil {
 		return nil, fmt.Errorf("img.checkBounds failed: %w", err)
 	}
@@ -796,6 +1085,12 @@ func NewFromPath(opt Options, filenames ...string) (*Converter, error) {
 // WriteTo processes the image(s) and writes the resulting .prg to w.
 // Returns error when analysis or conversion fails.
 func (c *Converter) WriteTo(w io.Writer) (n int64, err error) {
+	if c.font != nil {
+		return c.WriteFontTo(w)
+	}
+	if len(c.petsciiDocument) > 0 {
+		return c.WritePETSCIIDocumentTo(w)
+	}
 	if len(c.images) == 0 {
 		return 0, fmt.Errorf("no images found")
 	}
@@ -808,10 +1103,32 @@ func (c *Converter) WriteTo(w io.Writer) (n int64, err error) {
 			c.FinalGraphicsType = img.graphicsType
 		}
 	}()
+	if c.opt.SplitScreen != "" {
+		return c.WriteSplitScreenTo(w)
+	}
+	if c.opt.SharedCharset {
+		return c.WriteSharedCharsetTo(w)
+	}
+	if c.opt.Petsciify {
+		return c.WritePetsciifyTo(w)
+	}
+	if c.opt.SpriteOverlay {
+		return c.WriteSpriteOverlayTo(w)
+	}
 	if err = img.analyze(); err != nil {
 		return 0, fmt.Errorf("analyze %q failed: %w", img.sourceFilename, err)
 	}
+	if c.opt.RowColors && len(c.images) == 1 && img.graphicsType != multiColorCharset && img.graphicsType != mixedCharset {
+		return 0, fmt.Errorf("-row-colors only supports mc and mixed charsets, not %s, use -mode mccharset or mixedcharset", img.graphicsType)
+	}
 
+	if len(c.images) == 2 && c.opt.Interlace && c.opt.CurrentGraphicsType == singleColorBitmap {
+		if !c.opt.Quiet {
+			fmt.Printf("hires interlace mode\n")
+		}
+		c.FinalGraphicsType = img.graphicsType
+		return c.WriteHiresInterlaceTo(w)
+	}
 	if (len(c.images) == 1 && img.graphicsType == multiColorInterlaceBitmap) || (len(c.images) == 2 && c.opt.Interlace) {
 		if !c.opt.Quiet {
 			fmt.Printf("interlace mode\n")
@@ -880,7 +1197,7 @@ func (c *Converter) WriteTo(w io.Writer) (n int64, err error) {
 			return 0, fmt.Errorf("img.Hires %q failed: %w", img.sourceFilename, err)
 		}
 	case singleColorCharset:
-		if c.opt.GraphicsMode != "" {
+		if c.opt.GraphicsMode != "" || c.opt.CharsetFile != "" {
 			if err = bruteforce(img.graphicsType, 1); err != nil {
 				return 0, err
 			}
@@ -912,6 +1229,15 @@ func (c *Converter) WriteTo(w io.Writer) (n int64, err error) {
 			return 0, fmt.Errorf("img.PETSCIICharset %q failed: %w", img.sourceFilename, err)
 		}
 	case ecmCharset:
+		if c.opt.GraphicsMode == "" && c.opt.CharsetFile == "" && c.opt.MaxUniqueChars == 0 {
+			if wt, err = img.ECMPETSCIICharset(); err == nil {
+				if !c.opt.Quiet {
+					fmt.Printf("detected ecm petscii\n")
+				}
+				img.graphicsType = ecmPETSCIICharset
+				break
+			}
+		}
 		if err = bruteforce(img.graphicsType, 4); err != nil {
 			fmt.Printf("falling back to %s because bruteforce %q failed: %v\n", singleColorBitmap, img.sourceFilename, err)
 			img.graphicsType = singleColorBitmap
@@ -935,6 +1261,13 @@ func (c *Converter) WriteTo(w io.Writer) (n int64, err error) {
 				return 0, fmt.Errorf("img.Hires %q failed: %w", img.sourceFilename, err)
 			}
 		}
+	case ecmPETSCIICharset:
+		if err = bruteforce(img.graphicsType, 4); err != nil {
+			return 0, err
+		}
+		if wt, err = img.ECMPETSCIICharset(); err != nil {
+			return 0, fmt.Errorf("img.ECMPETSCIICharset %q failed: %w", img.sourceFilename, err)
+		}
 	case multiColorCharset:
 		if err = bruteforce(img.graphicsType, 4); err != nil {
 			if c.opt.GraphicsMode != "" {
@@ -974,10 +1307,14 @@ func (c *Converter) WriteTo(w io.Writer) (n int64, err error) {
 		if wt, err = img.SingleColorSprites(); err != nil {
 			return 0, fmt.Errorf("img.SingleColorSprites %q failed: %w", img.sourceFilename, err)
 		}
-	case multiColorSprites:
+	case multiColorSprites, mixedSprites:
 		if wt, err = img.MultiColorSprites(); err != nil {
 			return 0, fmt.Errorf("img.MultiColorSprites %q failed: %w", img.sourceFilename, err)
 		}
+	case layeredSprites:
+		if wt, err = img.LayeredSprites(); err != nil {
+			return 0, fmt.Errorf("img.LayeredSprites %q failed: %w", img.sourceFilename, err)
+		}
 	case mixedCharset:
 		if err = bruteforce(img.graphicsType, 4); err != nil {
 			if c.opt.GraphicsMode != "" {
@@ -1017,6 +1354,13 @@ func (c *Converter) WriteTo(w io.Writer) (n int64, err error) {
 		return 0, fmt.Errorf("unsupported graphicsType %q for %q", img.graphicsType, img.sourceFilename)
 	}
 
+	if c.opt.PETSCIIExport != "" {
+		pet, ok := wt.(PETSCIICharset)
+		if !ok {
+			return 0, fmt.Errorf("-petscii-export only supports petscii, not %s", img.graphicsType)
+		}
+		return c.exportPETSCII(w, []PETSCIICharset{pet})
+	}
 	if c.opt.Symbols {
 		if s, ok := wt.(Symbolser); ok {
 			c.Symbols = append(c.Symbols, s.Symbols()...)
@@ -1132,6 +1476,11 @@ func (k Koala) WriteTo(w io.Writer) (n int64, err error) {
 	if err != nil {
 		return n, fmt.Errorf("link.WriteMap failed: %w", err)
 	}
+	if !k.Overlay.empty() {
+		if _, err = link.WriteMap(k.Overlay.linkMap()); err != nil {
+			return n, fmt.Errorf("link.WriteMap failed: %w", err)
+		}
+	}
 	if !k.opt.Display {
 		return link.WriteTo(w)
 	}
@@ -1159,6 +1508,11 @@ func (h Hires) WriteTo(w io.Writer) (n int64, err error) {
 	if err != nil {
 		return n, fmt.Errorf("link.WriteMap failed: %w", err)
 	}
+	if !h.Overlay.empty() {
+		if _, err = link.WriteMap(h.Overlay.linkMap()); err != nil {
+			return n, fmt.Errorf("link.WriteMap failed: %w", err)
+		}
+	}
 	if !h.opt.Display {
 		return link.WriteTo(w)
 	}
@@ -1187,9 +1541,27 @@ func (c MultiColorCharset) WriteTo(w io.Writer) (n int64, err error) {
 	if err != nil {
 		return n, fmt.Errorf("link.WriteMap failed: %w", err)
 	}
+	if err = writeCharsetBands(link, c.Bands); err != nil {
+		return n, fmt.Errorf("writeCharsetBands failed: %w", err)
+	}
+	if c.opt.RowColors {
+		_, err = link.WriteMap(LinkMap{
+			CharsetRowD022Address: c.RowD022Color[:],
+			CharsetRowD023Address: c.RowD023Color[:],
+		})
+		if err != nil {
+			return n, fmt.Errorf("link.WriteMap failed: %w", err)
+		}
+	}
 	if !c.opt.Display {
 		return link.WriteTo(w)
 	}
+	if len(c.Bands) > 0 {
+		return n, fmt.Errorf("the %s displayer does not support -charset-splits", multiColorCharset)
+	}
+	if c.opt.RowColors {
+		return n, fmt.Errorf("the %s displayer does not support -row-colors, the d022/d023 raster splits are left to the user", multiColorCharset)
+	}
 	if _, err = link.WritePrg(mixedCharset.newHeader()); err != nil {
 		return n, fmt.Errorf("link.WritePrg failed: %w", err)
 	}
@@ -1211,9 +1583,15 @@ func (c SingleColorCharset) WriteTo(w io.Writer) (n int64, err error) {
 	if err != nil {
 		return n, fmt.Errorf("link.WriteMap failed: %w", err)
 	}
+	if err = writeCharsetBands(link, c.Bands); err != nil {
+		return n, fmt.Errorf("writeCharsetBands failed: %w", err)
+	}
 	if !c.opt.Display {
 		return link.WriteTo(w)
 	}
+	if len(c.Bands) > 0 {
+		return n, fmt.Errorf("the %s displayer does not support -charset-splits", singleColorCharset)
+	}
 	if _, err = link.WritePrg(singleColorCharset.newHeader()); err != nil {
 		return n, fmt.Errorf("link.WritePrg failed: %w", err)
 	}
@@ -1238,9 +1616,27 @@ func (c MixedCharset) WriteTo(w io.Writer) (n int64, err error) {
 	if err != nil {
 		return n, fmt.Errorf("link.WriteMap failed: %w", err)
 	}
+	if err = writeCharsetBands(link, c.Bands); err != nil {
+		return n, fmt.Errorf("writeCharsetBands failed: %w", err)
+	}
+	if c.opt.RowColors {
+		_, err = link.WriteMap(LinkMap{
+			CharsetRowD022Address: c.RowD022Color[:],
+			CharsetRowD023Address: c.RowD023Color[:],
+		})
+		if err != nil {
+			return n, fmt.Errorf("link.WriteMap failed: %w", err)
+		}
+	}
 	if !c.opt.Display {
 		return link.WriteTo(w)
 	}
+	if len(c.Bands) > 0 {
+		return n, fmt.Errorf("the %s displayer does not support -charset-splits", mixedCharset)
+	}
+	if c.opt.RowColors {
+		return n, fmt.Errorf("the %s displayer does not support -row-colors, the d022/d023 raster splits are left to the user", mixedCharset)
+	}
 	if _, err = link.WritePrg(mixedCharset.newHeader()); err != nil {
 		return n, fmt.Errorf("link.WritePrg failed: %w", err)
 	}
@@ -1264,6 +1660,9 @@ func (c PETSCIICharset) WriteTo(w io.Writer) (n int64, err error) {
 	if !c.opt.Display {
 		return link.WriteTo(w)
 	}
+	if !isBuiltinROMCharset(c.ROMCharset) {
+		return n, fmt.Errorf("the petscii displayer does not support the %q rom charset, only uppercase and lowercase", c.ROMCharset)
+	}
 	if _, err = link.WritePrg(petsciiCharset.newHeader()); err != nil {
 		return n, fmt.Errorf("link.WritePrg failed: %w", err)
 	}
@@ -1273,11 +1672,7 @@ func (c PETSCIICharset) WriteTo(w io.Writer) (n int64, err error) {
 		link.Block(0xac00, 0xcf28)
 	}
 	if !c.opt.Quiet {
-		if c.Lowercase == 1 {
-			fmt.Println("lowercase rom charset found")
-		} else {
-			fmt.Println("uppercase rom charset found")
-		}
+		fmt.Printf("%s rom charset found\n", c.ROMCharset)
 	}
 	if err = injectSID(link, c.opt.IncludeSID, c.opt.Quiet); err != nil {
 		return n, fmt.Errorf("injectSID failed: %w", err)
@@ -1313,21 +1708,26 @@ func (c ECMCharset) WriteTo(w io.Writer) (n int64, err error) {
 }
 
 func (s SingleColorSprites) WriteTo(w io.Writer) (n int64, err error) {
-	header := defaultHeader()
+	header := spriteHeader(s.opt)
 	if s.opt.Display {
 		header = singleColorSprites.newHeader()
 		header = append(header, s.Columns, s.Rows, s.BackgroundColor, s.SpriteColor)
+		return writeData(w, header, s.Bitmap[:])
 	}
-	return writeData(w, header, s.Bitmap[:])
+	return writeData(w, header, s.Bitmap[:], s.Colors, s.Index)
 }
 
 func (s MultiColorSprites) WriteTo(w io.Writer) (n int64, err error) {
-	header := defaultHeader()
+	header := spriteHeader(s.opt)
 	if s.opt.Display {
+		if slices.Contains(s.Hires, true) {
+			return n, fmt.Errorf("mixed sprites have no displayer support")
+		}
 		header = multiColorSprites.newHeader()
 		header = append(header, s.Columns, s.Rows, s.BackgroundColor, s.D025Color, s.SpriteColor, s.D026Color)
+		return writeData(w, header, s.Bitmap[:])
 	}
-	return writeData(w, header, s.Bitmap[:])
+	return writeData(w, header, s.Bitmap[:], s.Colors, s.Index)
 }
 
 func writeData(w io.Writer, data ...[]byte) (n int64, err error) {
@@ -1350,5 +1750,25 @@ func DestinationFilename(filename string, opt Options) (destfilename string) {
 	if opt.OutFile != "" {
 		return destfilename + opt.OutFile
 	}
-	return destfilename + filepath.Base(strings.TrimSuffix(filename, filepath.Ext(filename))+".prg")
+	base := strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+	ext := PETSCIIExportExtension(opt.PETSCIIExport)
+	destfilename += base + ext
+	if samePath(destfilename, filename) {
+		// do not overwrite the input document, e.g. a .petmate exported to petmate.
+		destfilename = strings.TrimSuffix(destfilename, ext) + "_out" + ext
+	}
+	return destfilename
+}
+
+// samePath returns true if path a and b resolve to the same absolute path.
+func samePath(a, b string) bool {
+	absa, err := filepath.Abs(a)
+	if err != nil {
+		return false
+	}
+	absb, err := filepath.Abs(b)
+	if err != nil {
+		return false
+	}
+	return absa == absb
 }
@@ -2,6 +2,8 @@ package png2prg
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"testing"
 )
 
@@ -85,3 +87,65 @@ func BenchmarkNewFromPathNoCrunchParallel(b *testing.B) {
 		}
 	})
 }
+
+// TestSpritesUnchanged verifies the default sprite output is byte for byte identical to earlier versions.
+// The sprites use the same color, so the 64th byte is 0 and there is no color table.
+func TestSpritesUnchanged(t *testing.T) {
+	t.Parallel()
+	testCases := map[string]string{
+		"testdata/sprites_tank_singlecolor.png": "7f19a325a153434ed6c283fb34f05a6e2fe2d10323c436b68aa42a936888ca6b",
+		"testdata/sprites_tank_multicolor.png":  "b6716d9cb94026eab85e8b7cf30d00993e496d5e709040f5a1afb09b8e4fa912",
+	}
+	for path, want := range testCases {
+		p, err := NewFromPath(Options{Quiet: true}, path)
+		if err != nil {
+			t.Fatalf("NewFromPath %q failed: %v", path, err)
+		}
+		buf := &bytes.Buffer{}
+		if _, err = p.WriteTo(buf); err != nil {
+			t.Fatalf("WriteTo %q failed: %v", path, err)
+		}
+		if buf.Len() != 2+2*64 {
+			t.Errorf("%q: got %d bytes, want %d", path, buf.Len(), 2+2*64)
+		}
+		sum := sha256.Sum256(buf.Bytes())
+		if got := hex.EncodeToString(sum[:]); got != want {
+			t.Errorf("%q: got sha256 %s, want %s", path, got, want)
+		}
+	}
+}
+
+func TestSpriteAnimationDisplayer(t *testing.T) {
+	t.Parallel()
+	path := "testdata/sprites_tank_multicolor.png"
+	p, err := NewFromPath(Options{Quiet: true, Display: true, NoCrunch: true, FrameDelay: 5}, path, path)
+	if err != nil {
+		t.Fatalf("NewFromPath %q failed: %v", path, err)
+	}
+	buf := &bytes.Buffer{}
+	if _, err = p.WriteTo(buf); err != nil {
+		t.Fatalf("WriteTo %q failed: %v", path, err)
+	}
+	prg := buf.Bytes()
+	at := func(addr, n int) []byte {
+		return prg[addr-0x0801+2 : addr-0x0801+2+n]
+	}
+	code := spritesDisplayAnim[0x0829-0x0801+2:]
+	if !bytes.Equal(at(0x0829, len(code)), code) {
+		t.Fatalf("%q: the displayer is not linked at $0829", path)
+	}
+	if got := at(DisplayerSettingsStart+7, 4); !bytes.Equal(got, []byte{5, 0, 0, 0}) {
+		t.Errorf("%q: got displayer settings %v, want [5 0 0 0]", path, got)
+	}
+	// 1 column, 2 rows, d021, d025, d026, 2 sprites per frame, 2 frames and the delay table at $2100.
+	want := []byte{1, 2, 11, 3, 7, 2, 2, 0x00, 0x21}
+	if got := at(spriteAnimationSettings, len(want)); !bytes.Equal(got, want) {
+		t.Errorf("%q: got settings %v, want %v", path, got, want)
+	}
+	if got := at(spriteAnimationStart+4*64, 2); !bytes.Equal(got, []byte{5, 5}) {
+		t.Errorf("%q: got frame delays %v, want [5 5]", path, got)
+	}
+	if len(prg) != spriteAnimationStart+4*64+2-0x0801+2 {
+		t.Errorf("%q: got %d bytes, want the prg to end after the frame delay table", path, len(prg))
+	}
+}
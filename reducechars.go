@@ -0,0 +1,176 @@
+package png2prg
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"log"
+	"math"
+	"math/bits"
+	"os"
+	"slices"
+)
+
+// hiresCharDistance returns the number of differing pixels between singlecolor chars a and b.
+func hiresCharDistance(a, b charBytes) (d int) {
+	for i := range a {
+		d += bits.OnesCount8(a[i] ^ b[i])
+	}
+	return d
+}
+
+// multiColorCharDistance returns the number of differing bitpairs between multicolor chars a and b.
+func multiColorCharDistance(a, b charBytes) (d int) {
+	for i := range a {
+		x := a[i] ^ b[i]
+		d += bits.OnesCount8((x | x>>1) & 0x55)
+	}
+	return d
+}
+
+// reduceChars merges the most similar chars in cbufs until it packs to max unique chars, including keep.
+// The chars in keep (eg a prebuilt charset) are never altered.
+// Chars marked in mc are displayed in multicolor, so their distance is measured in bitpairs.
+// The cost of merging char a into b is the number of changed pixels, multiplied by the number of times a is used.
+// The altered chars are stored in cbufs, the packed screen and charset are returned.
+func (img *sourceImage) reduceChars(cbufs *[FullScreenChars]charBytes, mc [FullScreenChars]bool, keep []charBytes, max int) (screen [FullScreenChars]byte, charset []charBytes, err error) {
+	if img.opt.MaxUniqueChars < max {
+		max = img.opt.MaxUniqueChars
+	}
+	if len(keep) > max {
+		return screen, nil, fmt.Errorf("prebuilt charset of %d chars exceeds -max-chars %d", len(keep), max)
+	}
+	uniq := slices.Clone(keep)
+	numHires, numMC := make([]int, len(uniq)), make([]int, len(uniq))
+	for char, cbuf := range cbufs {
+		i := slices.Index(uniq, cbuf)
+		if i < 0 {
+			uniq = append(uniq, cbuf)
+			numHires, numMC = append(numHires, 0), append(numMC, 0)
+			i = len(uniq) - 1
+		}
+		if mc[char] {
+			numMC[i]++
+		} else {
+			numHires[i]++
+		}
+	}
+
+	alive := make([]bool, len(uniq))
+	target := make([]int, len(uniq))
+	for i := range uniq {
+		alive[i], target[i] = true, i
+	}
+	cost := func(a, b int) int {
+		return numHires[a]*hiresCharDistance(uniq[a], uniq[b]) + numMC[a]*multiColorCharDistance(uniq[a], uniq[b])
+	}
+	best, bestCost := make([]int, len(uniq)), make([]int, len(uniq))
+	findBest := func(a int) {
+		best[a], bestCost[a] = -1, math.MaxInt
+		for b := range uniq {
+			if b == a || !alive[b] {
+				continue
+			}
+			if c := cost(a, b); c < bestCost[a] {
+				best[a], bestCost[a] = b, c
+			}
+		}
+	}
+	for a := len(keep); a < len(uniq); a++ {
+		findBest(a)
+	}
+
+	for count := len(uniq); count > max; count-- {
+		a := -1
+		for i := len(keep); i < len(uniq); i++ {
+			if alive[i] && best[i] >= 0 && (a < 0 || bestCost[i] < bestCost[a]) {
+				a = i
+			}
+		}
+		if a < 0 {
+			return screen, nil, fmt.Errorf("unable to reduce %d chars to %d", count, max)
+		}
+		b := best[a]
+		if img.opt.VeryVerbose {
+			log.Printf("merging char %d into char %d, cost %d", a, b, bestCost[a])
+		}
+		alive[a], target[a] = false, b
+		numHires[b] += numHires[a]
+		numMC[b] += numMC[a]
+		for i := len(keep); i < len(uniq); i++ {
+			if alive[i] && (i == b || best[i] == a) {
+				findBest(i)
+			}
+		}
+	}
+
+	charset = slices.Clone(keep)
+	altered, pixels := 0, 0
+	var diff *image.RGBA
+	if img.opt.MaxUniqueCharsDiff != "" {
+		diff = image.NewRGBA(image.Rect(0, 0, FullScreenWidth, FullScreenHeight))
+		for y := 0; y < FullScreenHeight; y++ {
+			for x := 0; x < FullScreenWidth; x++ {
+				diff.Set(x, y, img.At(x, y))
+			}
+		}
+	}
+	for char, orig := range cbufs {
+		i := slices.Index(uniq, orig)
+		for target[i] != i {
+			i = target[i]
+		}
+		cbuf := uniq[i]
+		cur := slices.Index(charset, cbuf)
+		if cur < 0 {
+			charset = append(charset, cbuf)
+			cur = len(charset) - 1
+		}
+		screen[char] = byte(cur)
+		cbufs[char] = cbuf
+		if cbuf == orig {
+			continue
+		}
+		d := hiresCharDistance(orig, cbuf)
+		if mc[char] {
+			d = multiColorCharDistance(orig, cbuf)
+		}
+		altered++
+		pixels += d
+		x, y := xyFromChar(char)
+		if img.opt.Verbose {
+			log.Printf("altered char %d (x=%d y=%d) by %d pixels", char, x, y, d)
+		}
+		if diff != nil {
+			for py := 0; py < 8; py++ {
+				for px := 0; px < 8; px++ {
+					mask := byte(1 << (7 - px))
+					if mc[char] {
+						mask = 3 << (6 - px&6)
+					}
+					if (orig[py]^cbuf[py])&mask != 0 {
+						diff.Set(x+px, y+py, color.RGBA{0xff, 0x00, 0x00, 0xff})
+					}
+				}
+			}
+		}
+	}
+	if !img.opt.Quiet && len(charset) < len(uniq) {
+		fmt.Printf("reduced %d to %d unique chars, altered %d chars by %d pixels in total\n", len(uniq), len(charset), altered, pixels)
+	}
+	if diff != nil {
+		f, err := os.Create(img.opt.MaxUniqueCharsDiff)
+		if err != nil {
+			return screen, nil, fmt.Errorf("os.Create %q failed: %w", img.opt.MaxUniqueCharsDiff, err)
+		}
+		defer f.Close()
+		if err = png.Encode(f, diff); err != nil {
+			return screen, nil, fmt.Errorf("png.Encode %q failed: %w", img.opt.MaxUniqueCharsDiff, err)
+		}
+		if !img.opt.Quiet {
+			fmt.Printf("write diff of altered pixels to %q\n", img.opt.MaxUniqueCharsDiff)
+		}
+	}
+	return screen, charset, nil
+}
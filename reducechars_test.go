@@ -0,0 +1,50 @@
+package png2prg
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReduceChars(t *testing.T) {
+	t.Parallel()
+	img := &sourceImage{opt: Options{Quiet: true, MaxUniqueChars: MaxChars}}
+	empty := charBytes{}
+	dot := charBytes{0x01}
+	line := charBytes{0xff}
+	full := charBytes{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+
+	// the dot is 1 pixel off the empty char and merged first, then the line (8 pixels off empty, 56 off full).
+	cbufs := [FullScreenChars]charBytes{}
+	cbufs[1], cbufs[2], cbufs[3] = dot, line, full
+	screen, charset, err := img.reduceChars(&cbufs, [FullScreenChars]bool{}, nil, 3)
+	require.Nil(t, err)
+	assert.Equal(t, []charBytes{empty, line, full}, charset)
+	assert.Equal(t, empty, cbufs[1])
+	assert.Equal(t, byte(0), screen[1])
+	assert.Equal(t, byte(1), screen[2])
+	assert.Equal(t, byte(2), screen[3])
+
+	cbufs = [FullScreenChars]charBytes{}
+	cbufs[1], cbufs[2], cbufs[3] = dot, line, full
+	_, charset, err = img.reduceChars(&cbufs, [FullScreenChars]bool{}, nil, 2)
+	require.Nil(t, err)
+	assert.Equal(t, []charBytes{empty, full}, charset)
+	assert.Equal(t, empty, cbufs[2])
+
+	// kept chars are never altered, the other chars are merged into them.
+	cbufs = [FullScreenChars]charBytes{}
+	cbufs[1] = line
+	_, charset, err = img.reduceChars(&cbufs, [FullScreenChars]bool{}, []charBytes{full, dot}, 2)
+	require.Nil(t, err)
+	assert.Equal(t, []charBytes{full, dot}, charset)
+	assert.Equal(t, dot, cbufs[0])
+
+	// in multicolor, a bitpair counts as 1 pixel.
+	assert.Equal(t, 1, multiColorCharDistance(empty, charBytes{0x03}))
+	assert.Equal(t, 2, hiresCharDistance(empty, charBytes{0x03}))
+
+	_, _, err = img.reduceChars(&cbufs, [FullScreenChars]bool{}, []charBytes{empty, dot, full}, 2)
+	assert.NotNil(t, err)
+}
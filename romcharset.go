@@ -0,0 +1,109 @@
+package png2prg
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// A ROMCharset is a charset that is permanently available in c64 memory, like the uppercase and lowercase rom charsets.
+// Images that only use its chars are converted without storing the charset.
+type ROMCharset struct {
+	Name      string
+	Chars     []charBytes
+	Lowercase byte // 1 for the builtin lowercase rom charset, as used by the displayers
+}
+
+// builtinROMCharsets returns the embedded c64 uppercase and lowercase rom charsets.
+func builtinROMCharsets() []ROMCharset {
+	return []ROMCharset{
+		{Name: "uppercase", Chars: romCharsetToCharBytes(romCharsetUppercasePrg)},
+		{Name: "lowercase", Chars: romCharsetToCharBytes(romCharsetLowercasePrg), Lowercase: 1},
+	}
+}
+
+// isBuiltinROMCharset returns true if name is one of the builtin rom charsets.
+// Only these are supported by the displayers and the petscii document formats.
+func isBuiltinROMCharset(name string) bool {
+	return name == "uppercase" || name == "lowercase"
+}
+
+// builtinROMCharsetName returns the name of the builtin uppercase or lowercase rom charset.
+func builtinROMCharsetName(lowercase byte) string {
+	if lowercase == 1 {
+		return "lowercase"
+	}
+	return "uppercase"
+}
+
+// LoadROMCharsets returns the rom charsets of the comma separated spec, in order of preference.
+// Each entry is either the name of a builtin rom charset (uppercase or lowercase),
+// or a charset file (.bin, .prg or image) named after its filename without extension.
+func LoadROMCharsets(spec string) (rr []ROMCharset, err error) {
+	builtin := builtinROMCharsets()
+	seen := map[string]bool{}
+NEXT:
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		for _, r := range builtin {
+			if entry == r.Name {
+				if seen[r.Name] {
+					return nil, fmt.Errorf("rom charset %q is listed twice", r.Name)
+				}
+				seen[r.Name] = true
+				rr = append(rr, r)
+				continue NEXT
+			}
+		}
+		r := ROMCharset{Name: strings.TrimSuffix(filepath.Base(entry), filepath.Ext(entry))}
+		if isBuiltinROMCharset(r.Name) {
+			return nil, fmt.Errorf("rom charset file %q can not be named like the builtin %s rom charset", entry, r.Name)
+		}
+		if seen[r.Name] {
+			return nil, fmt.Errorf("rom charset %q is listed twice", r.Name)
+		}
+		seen[r.Name] = true
+		if r.Chars, err = LoadCharsetFile(entry); err != nil {
+			return nil, fmt.Errorf("LoadCharsetFile failed: %w", err)
+		}
+		rr = append(rr, r)
+	}
+	if len(rr) == 0 {
+		return nil, fmt.Errorf("no rom charsets found in %q", spec)
+	}
+	return rr, nil
+}
+
+// romCharsets returns the rom charsets of -rom-charsets, or the builtin ones by default.
+func (o Options) romCharsets() []ROMCharset {
+	if len(o.romCharsetList) > 0 {
+		return o.romCharsetList
+	}
+	return builtinROMCharsets()
+}
+
+// romCharsetSymbols returns the lowercase symbol and the romcharset symbol, the index of the rom charset named name
+// in -rom-charsets. By default the index is 0 for uppercase and 1 for lowercase.
+func (o Options) romCharsetSymbols(name string, lowercase byte) []c64Symbol {
+	index := int(lowercase)
+	for i, r := range o.romCharsets() {
+		if r.Name == name {
+			index = i
+			break
+		}
+	}
+	return []c64Symbol{{"lowercase", int(lowercase)}, {"romcharset", index}}
+}
+
+// romCharset returns the rom charset named name.
+func (o Options) romCharset(name string) (ROMCharset, error) {
+	for _, r := range o.romCharsets() {
+		if r.Name == name {
+			return r, nil
+		}
+	}
+	return ROMCharset{}, fmt.Errorf("rom charset %q not found", name)
+}
@@ -0,0 +1,176 @@
+package png2prg
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+)
+
+const (
+	SharedCharsetAddress    = 0x2000
+	SharedCharsetScreenBase = 0x2800
+	// only the screens need to be in the vic bank of the charset, $0000-$3fff.
+	SharedCharsetMaxScreens = (VICBankSize - SharedCharsetScreenBase) / 0x400
+	// the colorram and colors of each screen are stored after the vic bank.
+	SharedCharsetColorBase = VICBankSize
+)
+
+// A SharedCharset contains one packed charset, shared by multiple independent screens.
+// The screens are packed 0x400 bytes apart in the vic bank of the charset,
+// the colorram of each screen is stored in a 0x400 byte block from 0x4000 with the colors at offset 0x3e8.
+type SharedCharset struct {
+	GraphicsType GraphicsType
+	Bitmap       [0x800]byte
+	Screens      []SharedCharsetScreen
+	opt          Options
+}
+
+// A SharedCharsetScreen is one screen of a SharedCharset.
+type SharedCharsetScreen struct {
+	SourceFilename  string
+	Screen          [1000]byte
+	D800Color       [1000]byte
+	BorderColor     byte
+	BackgroundColor byte
+	D022Color       byte
+	D023Color       byte
+}
+
+// screenAddress returns the address of screen i.
+func (s SharedCharset) screenAddress(i int) int {
+	return SharedCharsetScreenBase + i*0x400
+}
+
+// colorRAMAddress returns the address of the colorram of screen i, followed by its colors at offset 0x3e8.
+func (s SharedCharset) colorRAMAddress(i int) int {
+	return SharedCharsetColorBase + i*0x400
+}
+
+// WriteSharedCharsetTo converts all images to sc, mc or mixed charset screens using one shared charset
+// and writes the resulting SharedCharset .prg to w.
+func (c *Converter) WriteSharedCharsetTo(w io.Writer) (n int64, err error) {
+	switch {
+	case len(c.images) < 2:
+		return n, fmt.Errorf("-shared-charset requires at least 2 images, not %d", len(c.images))
+	case len(c.images) > SharedCharsetMaxScreens:
+		return n, fmt.Errorf("-shared-charset supports max %d images, not %d", SharedCharsetMaxScreens, len(c.images))
+	case c.opt.CharsetFile != "":
+		return n, fmt.Errorf("-shared-charset can not be combined with -charset")
+	case c.opt.CharsetSplits != "":
+		return n, fmt.Errorf("-shared-charset can not be combined with -charset-splits")
+	case c.opt.RowColors:
+		return n, fmt.Errorf("-shared-charset can not be combined with -row-colors")
+	}
+
+	s := SharedCharset{opt: c.opt}
+	charset := []charBytes{}
+	for i := range c.images {
+		img := &c.images[i]
+		if err = img.analyze(); err != nil {
+			return n, fmt.Errorf("analyze %q failed: %w", img.sourceFilename, err)
+		}
+		gfxtype := img.graphicsType
+		if gfxtype == petsciiCharset {
+			gfxtype = singleColorCharset
+		}
+		if i == 0 {
+			s.GraphicsType = gfxtype
+		}
+		if gfxtype != s.GraphicsType {
+			return n, fmt.Errorf("mixed graphicsmodes detected %q != %q in %q", gfxtype, s.GraphicsType, img.sourceFilename)
+		}
+		prev := len(charset)
+		scr := SharedCharsetScreen{SourceFilename: img.sourceFilename}
+		switch gfxtype {
+		case singleColorCharset:
+			ch, err := img.SingleColorCharset(charset)
+			if err != nil {
+				return n, fmt.Errorf("img.SingleColorCharset %q failed: %w", img.sourceFilename, err)
+			}
+			charset = ch.CharBytes()
+			scr.Screen, scr.D800Color = ch.Screen, ch.D800Color
+			scr.BorderColor, scr.BackgroundColor = ch.BorderColor, ch.BackgroundColor
+		case multiColorCharset:
+			ch, err := img.MultiColorCharset(charset)
+			if err != nil {
+				return n, fmt.Errorf("img.MultiColorCharset %q failed: %w", img.sourceFilename, err)
+			}
+			charset = ch.CharBytes()
+			scr.Screen, scr.D800Color = ch.Screen, ch.D800Color
+			scr.BorderColor, scr.BackgroundColor, scr.D022Color, scr.D023Color = ch.BorderColor, ch.BackgroundColor, ch.D022Color, ch.D023Color
+		case mixedCharset:
+			ch, err := img.MixedCharset(charset)
+			if err != nil {
+				return n, fmt.Errorf("img.MixedCharset %q failed: %w", img.sourceFilename, err)
+			}
+			charset = ch.CharBytes()
+			scr.Screen, scr.D800Color = ch.Screen, ch.D800Color
+			scr.BorderColor, scr.BackgroundColor, scr.D022Color, scr.D023Color = ch.BorderColor, ch.BackgroundColor, ch.D022Color, ch.D023Color
+		default:
+			return n, fmt.Errorf("-shared-charset does not support %q, only sccharset, mccharset and mixedcharset", gfxtype)
+		}
+		if !c.opt.Quiet {
+			fmt.Printf("screen %d %q added %d new chars to the shared charset\n", i, img.sourceFilename, len(charset)-prev)
+		}
+		s.Screens = append(s.Screens, scr)
+	}
+	for i := range charset {
+		for j := range charset[i] {
+			s.Bitmap[i*8+j] = charset[i][j]
+		}
+	}
+	if !c.opt.Quiet {
+		fmt.Printf("used %d unique chars in the shared charset of %d screens\n", len(charset), len(s.Screens))
+	}
+	c.FinalGraphicsType = s.GraphicsType
+	if c.opt.Symbols {
+		c.Symbols = append(c.Symbols, s.Symbols()...)
+	}
+	return s.WriteTo(w)
+}
+
+func (s SharedCharset) Symbols() []c64Symbol {
+	syms := []c64Symbol{
+		{"bitmap", SharedCharsetAddress},
+		{"screens", len(s.Screens)},
+	}
+	for i, scr := range s.Screens {
+		nr := strconv.Itoa(i)
+		syms = append(syms, []c64Symbol{
+			{"screen" + nr, s.screenAddress(i)},
+			{"colorram" + nr, s.colorRAMAddress(i)},
+			{"colors" + nr, s.colorRAMAddress(i) + 0x3e8},
+			{"d020color" + nr, int(scr.BorderColor)},
+			{"d021color" + nr, int(scr.BackgroundColor)},
+		}...)
+		if s.GraphicsType != singleColorCharset {
+			syms = append(syms, []c64Symbol{
+				{"d022color" + nr, int(scr.D022Color)},
+				{"d023color" + nr, int(scr.D023Color)},
+			}...)
+		}
+	}
+	return syms
+}
+
+func (s SharedCharset) WriteTo(w io.Writer) (n int64, err error) {
+	if s.opt.Display {
+		return n, fmt.Errorf("there is no displayer for -shared-charset, omit -display")
+	}
+	link := NewLinker(SharedCharsetAddress, s.opt.VeryVerbose)
+	if _, err = link.WriteMap(LinkMap{SharedCharsetAddress: s.Bitmap[:]}); err != nil {
+		return n, fmt.Errorf("link.WriteMap failed: %w", err)
+	}
+	for i, scr := range s.Screens {
+		addr := Word(s.colorRAMAddress(i))
+		_, err = link.WriteMap(LinkMap{
+			Word(s.screenAddress(i)): scr.Screen[:],
+			addr:                     scr.D800Color[:],
+			addr + 0x3e8:             []byte{scr.BorderColor, scr.BackgroundColor, scr.D022Color, scr.D023Color},
+		})
+		if err != nil {
+			return n, fmt.Errorf("link.WriteMap failed: %w", err)
+		}
+	}
+	return link.WriteTo(w)
+}
@@ -0,0 +1,51 @@
+package png2prg
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSharedCharsetLayout(t *testing.T) {
+	t.Parallel()
+	s := SharedCharset{GraphicsType: multiColorCharset}
+	for i := 0; i < SharedCharsetMaxScreens; i++ {
+		scr := SharedCharsetScreen{BorderColor: byte(i), BackgroundColor: 1, D022Color: 2, D023Color: 3}
+		scr.Screen[0], scr.Screen[999] = byte(0x10+i), byte(0x20+i)
+		scr.D800Color[0], scr.D800Color[999] = byte(0x30+i), byte(0x40+i)
+		s.Screens = append(s.Screens, scr)
+	}
+	buf := &bytes.Buffer{}
+	_, err := s.WriteTo(buf)
+	require.Nil(t, err)
+	prg := buf.Bytes()
+	require.Equal(t, []byte{0x00, 0x20}, prg[:2])
+	at := func(addr int) byte { return prg[addr-SharedCharsetAddress+2] }
+
+	// the last screen ends just before $4000, the colorram of the last screen ends the prg.
+	assert.Equal(t, 6, SharedCharsetMaxScreens)
+	assert.Equal(t, 0x4000+5*0x400+0x3ec, SharedCharsetAddress+len(prg)-2)
+	for i := range s.Screens {
+		screen, colorram := 0x2800+i*0x400, 0x4000+i*0x400
+		assert.Equal(t, byte(0x10+i), at(screen), i)
+		assert.Equal(t, byte(0x20+i), at(screen+999), i)
+		assert.Equal(t, byte(0x30+i), at(colorram), i)
+		assert.Equal(t, byte(0x40+i), at(colorram+999), i)
+		assert.Equal(t, []byte{byte(i), 1, 2, 3}, prg[colorram+0x3e8-SharedCharsetAddress+2:][:4], i)
+	}
+	want := map[string]int{
+		"screen1":   0x2c00,
+		"screen5":   0x3c00,
+		"colorram1": 0x4400,
+		"colors5":   0x57e8,
+	}
+	for _, sym := range s.Symbols() {
+		if v, ok := want[sym.key]; ok {
+			assert.Equal(t, v, sym.value, sym.key)
+			delete(want, sym.key)
+		}
+	}
+	assert.Empty(t, want)
+}
@@ -0,0 +1,281 @@
+package png2prg
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+)
+
+const (
+	SplitScreenVICBank              = 0x8000
+	SplitScreenCharsetAddress       = 0x8000
+	SplitScreenCharsetScreenAddress = 0x8800
+	SplitScreenBitmapScreenAddress  = 0x8c00
+	SplitScreenColorRAMAddress      = 0x9000
+	SplitScreenColorsAddress        = 0x93e8
+	SplitScreenBitmapAddress        = 0xa000
+)
+
+// A SplitScreen combines a bitmap and a charset region of the same image, split at char row SplitRow.
+// All data is located in vic bank 2 ($8000-$bfff), the colorram is shared by both regions.
+type SplitScreen struct {
+	SourceFilename         string
+	BitmapType             GraphicsType
+	CharsetType            GraphicsType
+	BitmapTop              bool
+	SplitRow               int
+	Bitmap                 [8000]byte
+	BitmapScreen           [1000]byte
+	Charset                [0x800]byte
+	CharsetScreen          [1000]byte
+	D800Color              [1000]byte
+	BorderColor            byte
+	BitmapBackgroundColor  byte
+	CharsetBackgroundColor byte
+	D022Color              byte
+	D023Color              byte
+	Lowercase              byte // 0 = uppercase, 1 = lowercase, only for petscii
+	opt                    Options
+}
+
+// parseSplitScreen parses the -split-screen string in format "mode,row,mode", eg "koala,18,petscii".
+// One of the modes must be koala or hires, the other sccharset, mccharset, mixedcharset or petscii.
+func parseSplitScreen(in string) (top GraphicsType, row int, bottom GraphicsType, err error) {
+	a := strings.Split(in, ",")
+	if len(a) != 3 {
+		return top, row, bottom, fmt.Errorf("incorrect format %q, use mode,row,mode eg koala,18,petscii", in)
+	}
+	top, bottom = StringToGraphicsType(strings.TrimSpace(a[0])), StringToGraphicsType(strings.TrimSpace(a[2]))
+	if row, err = strconv.Atoi(strings.TrimSpace(a[1])); err != nil {
+		return top, row, bottom, fmt.Errorf("strconv.Atoi conversion of %q to integer failed: %w", a[1], err)
+	}
+	if row < 1 || row >= FullScreenRows {
+		return top, row, bottom, fmt.Errorf("incorrect split char row %d, it must be between 1 and %d", row, FullScreenRows-1)
+	}
+	isBitmap := func(t GraphicsType) bool {
+		return t == multiColorBitmap || t == singleColorBitmap
+	}
+	isCharset := func(t GraphicsType) bool {
+		return t == singleColorCharset || t == multiColorCharset || t == mixedCharset || t == petsciiCharset
+	}
+	if !(isBitmap(top) && isCharset(bottom)) && !(isCharset(top) && isBitmap(bottom)) {
+		return top, row, bottom, fmt.Errorf("unsupported combination %q, use koala or hires for one region and sccharset, mccharset, mixedcharset or petscii for the other", in)
+	}
+	return top, row, bottom, nil
+}
+
+// regionImage returns a 320x200 copy of the img, keeping only char rows start until end.
+// The other rows are filled with the most used color of the region, so they do not influence analysis.
+func (img *sourceImage) regionImage(start, end int) *image.RGBA {
+	count := map[colorKey]int{}
+	var fill color.Color = color.RGBA{}
+	max := 0
+	for y := start * 8; y < end*8; y++ {
+		for x := 0; x < FullScreenWidth; x++ {
+			col := img.At(x, y)
+			k := ColorKey(col)
+			count[k]++
+			if count[k] > max {
+				max = count[k]
+				fill = col
+			}
+		}
+	}
+	out := image.NewRGBA(image.Rect(0, 0, FullScreenWidth, FullScreenHeight))
+	for y := 0; y < FullScreenHeight; y++ {
+		for x := 0; x < FullScreenWidth; x++ {
+			if y >= start*8 && y < end*8 {
+				out.Set(x, y, img.At(x, y))
+				continue
+			}
+			out.Set(x, y, fill)
+		}
+	}
+	return out
+}
+
+// WriteSplitScreenTo converts the bitmap and charset regions of the image, as set by c.opt.SplitScreen,
+// and writes the resulting SplitScreen .prg to w.
+func (c *Converter) WriteSplitScreenTo(w io.Writer) (n int64, err error) {
+	if len(c.images) != 1 {
+		return n, fmt.Errorf("-split-screen requires exactly 1 image, not %d", len(c.images))
+	}
+	img := &c.images[0]
+	top, row, bottom, err := parseSplitScreen(c.opt.SplitScreen)
+	if err != nil {
+		return n, fmt.Errorf("parseSplitScreen failed: %w", err)
+	}
+	forceBorder := true
+	if err = img.findBorderColor(); err != nil {
+		forceBorder = false
+		if c.opt.Verbose {
+			log.Printf("skipping: findBorderColor failed: %v", err)
+		}
+	}
+	img.graphicsType = splitScreen
+
+	s := SplitScreen{
+		SourceFilename: img.sourceFilename,
+		SplitRow:       row,
+		BorderColor:    byte(img.border.C64Color),
+		opt:            c.opt,
+	}
+	regions := []struct {
+		gfxtype    GraphicsType
+		start, end int
+	}{
+		{top, 0, row},
+		{bottom, row, FullScreenRows},
+	}
+	for _, r := range regions {
+		opt := c.opt
+		opt.GraphicsMode = r.gfxtype.String()
+		opt.CurrentGraphicsType = r.gfxtype
+		if forceBorder {
+			opt.ForceBorderColor = int(img.border.C64Color)
+		}
+		opt.SplitScreen = ""
+		ri, err := NewSourceImage(opt, 0, img.regionImage(r.start, r.end))
+		if err != nil {
+			return n, fmt.Errorf("NewSourceImage %q failed: %w", img.sourceFilename, err)
+		}
+		ri.sourceFilename = fmt.Sprintf("%s char rows %d-%d", img.sourceFilename, r.start, r.end-1)
+		if err = ri.analyze(); err != nil {
+			return n, fmt.Errorf("analyze %q failed: %w", ri.sourceFilename, err)
+		}
+		first, last := r.start*40, r.end*40
+		switch r.gfxtype {
+		case multiColorBitmap:
+			k, err := ri.Koala()
+			if err != nil {
+				return n, fmt.Errorf("ri.Koala %q failed: %w", ri.sourceFilename, err)
+			}
+			copy(s.Bitmap[first*8:last*8], k.Bitmap[first*8:last*8])
+			copy(s.BitmapScreen[first:last], k.ScreenColor[first:last])
+			copy(s.D800Color[first:last], k.D800Color[first:last])
+			s.BitmapBackgroundColor = k.BackgroundColor
+		case singleColorBitmap:
+			h, err := ri.Hires()
+			if err != nil {
+				return n, fmt.Errorf("ri.Hires %q failed: %w", ri.sourceFilename, err)
+			}
+			copy(s.Bitmap[first*8:last*8], h.Bitmap[first*8:last*8])
+			copy(s.BitmapScreen[first:last], h.ScreenColor[first:last])
+		case singleColorCharset:
+			ch, err := ri.SingleColorCharset(nil)
+			if err != nil {
+				return n, fmt.Errorf("ri.SingleColorCharset %q failed: %w", ri.sourceFilename, err)
+			}
+			s.Charset = ch.Bitmap
+			copy(s.CharsetScreen[first:last], ch.Screen[first:last])
+			copy(s.D800Color[first:last], ch.D800Color[first:last])
+			s.CharsetBackgroundColor = ch.BackgroundColor
+		case multiColorCharset:
+			ch, err := ri.MultiColorCharset(nil)
+			if err != nil {
+				return n, fmt.Errorf("ri.MultiColorCharset %q failed: %w", ri.sourceFilename, err)
+			}
+			s.Charset = ch.Bitmap
+			copy(s.CharsetScreen[first:last], ch.Screen[first:last])
+			copy(s.D800Color[first:last], ch.D800Color[first:last])
+			s.CharsetBackgroundColor, s.D022Color, s.D023Color = ch.BackgroundColor, ch.D022Color, ch.D023Color
+		case mixedCharset:
+			ch, err := ri.MixedCharset(nil)
+			if err != nil {
+				return n, fmt.Errorf("ri.MixedCharset %q failed: %w", ri.sourceFilename, err)
+			}
+			s.Charset = ch.Bitmap
+			copy(s.CharsetScreen[first:last], ch.Screen[first:last])
+			copy(s.D800Color[first:last], ch.D800Color[first:last])
+			s.CharsetBackgroundColor, s.D022Color, s.D023Color = ch.BackgroundColor, ch.D022Color, ch.D023Color
+		case petsciiCharset:
+			ch, err := ri.PETSCIICharset()
+			if err != nil {
+				return n, fmt.Errorf("ri.PETSCIICharset %q failed: %w", ri.sourceFilename, err)
+			}
+			if !isBuiltinROMCharset(ch.ROMCharset) {
+				return n, fmt.Errorf("-split-screen petscii does not support the %q rom charset, only uppercase and lowercase", ch.ROMCharset)
+			}
+			copy(s.CharsetScreen[first:last], ch.Screen[first:last])
+			copy(s.D800Color[first:last], ch.D800Color[first:last])
+			s.CharsetBackgroundColor, s.Lowercase = ch.BackgroundColor, ch.Lowercase
+		}
+		if r.gfxtype == multiColorBitmap || r.gfxtype == singleColorBitmap {
+			s.BitmapType, s.BitmapTop = r.gfxtype, r.start == 0
+		} else {
+			s.CharsetType = r.gfxtype
+		}
+	}
+	if !c.opt.Quiet {
+		fmt.Printf("split screen at char row %d: %s and %s\n", row, top, bottom)
+	}
+	if c.opt.Symbols {
+		c.Symbols = append(c.Symbols, s.Symbols()...)
+	}
+	return s.WriteTo(w)
+}
+
+func (s SplitScreen) Symbols() []c64Symbol {
+	bitmapd016, charsetd016 := 0x08, 0x08
+	if s.BitmapType == multiColorBitmap {
+		bitmapd016 = 0x18
+	}
+	if s.CharsetType == multiColorCharset || s.CharsetType == mixedCharset {
+		charsetd016 = 0x18
+	}
+	charsetd018 := 0x20
+	if s.CharsetType == petsciiCharset {
+		charsetd018 = 0x24 | int(s.Lowercase)<<1
+	}
+	syms := []c64Symbol{
+		{"vicbank", SplitScreenVICBank},
+		{"dd00", 3 - SplitScreenVICBank/VICBankSize},
+		{"bitmap", SplitScreenBitmapAddress},
+		{"bitmapscreenram", SplitScreenBitmapScreenAddress},
+	}
+	if s.CharsetType != petsciiCharset {
+		syms = append(syms, c64Symbol{"charset", SplitScreenCharsetAddress})
+	}
+	return append(syms, []c64Symbol{
+		{"charsetscreenram", SplitScreenCharsetScreenAddress},
+		{"colorram", SplitScreenColorRAMAddress},
+		{"d020color", int(s.BorderColor)},
+		{"bitmapd021color", int(s.BitmapBackgroundColor)},
+		{"charsetd021color", int(s.CharsetBackgroundColor)},
+		{"d022color", int(s.D022Color)},
+		{"d023color", int(s.D023Color)},
+		{"bitmapd011", 0x3b},
+		{"bitmapd016", bitmapd016},
+		{"bitmapd018", 0x38},
+		{"charsetd011", 0x1b},
+		{"charsetd016", charsetd016},
+		{"charsetd018", charsetd018},
+		{"splitrow", s.SplitRow},
+		{"splitrasterline", 0x33 + s.SplitRow*8},
+	}...)
+}
+
+func (s SplitScreen) WriteTo(w io.Writer) (n int64, err error) {
+	if s.opt.Display {
+		return n, fmt.Errorf("there is no displayer for -split-screen, omit -display")
+	}
+	link := NewLinker(SplitScreenVICBank, s.opt.VeryVerbose)
+	m := LinkMap{
+		SplitScreenCharsetScreenAddress: s.CharsetScreen[:],
+		SplitScreenBitmapScreenAddress:  s.BitmapScreen[:],
+		SplitScreenColorRAMAddress:      s.D800Color[:],
+		SplitScreenColorsAddress:        []byte{s.BorderColor, s.BitmapBackgroundColor, s.CharsetBackgroundColor, s.D022Color, s.D023Color},
+		SplitScreenBitmapAddress:        s.Bitmap[:],
+	}
+	if s.CharsetType != petsciiCharset {
+		m[SplitScreenCharsetAddress] = s.Charset[:]
+	}
+	if _, err = link.WriteMap(m); err != nil {
+		return n, fmt.Errorf("link.WriteMap failed: %w", err)
+	}
+	return link.WriteTo(w)
+}
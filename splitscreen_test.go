@@ -0,0 +1,81 @@
+package png2prg
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitScreenLayout(t *testing.T) {
+	t.Parallel()
+	s := SplitScreen{
+		BitmapType:             multiColorBitmap,
+		CharsetType:            multiColorCharset,
+		SplitRow:               18,
+		BorderColor:            1,
+		BitmapBackgroundColor:  2,
+		CharsetBackgroundColor: 3,
+		D022Color:              4,
+		D023Color:              5,
+	}
+	s.Charset[0], s.Charset[0x7ff] = 0x11, 0x12
+	s.CharsetScreen[0], s.CharsetScreen[999] = 0x21, 0x22
+	s.BitmapScreen[0], s.BitmapScreen[999] = 0x31, 0x32
+	s.D800Color[0], s.D800Color[999] = 0x41, 0x42
+	s.Bitmap[0], s.Bitmap[7999] = 0x51, 0x52
+
+	buf := &bytes.Buffer{}
+	_, err := s.WriteTo(buf)
+	require.Nil(t, err)
+	prg := buf.Bytes()
+	require.Equal(t, []byte{0x00, 0x80}, prg[:2])
+	require.Len(t, prg, 2+0xa000+8000-0x8000)
+	at := func(addr int) byte { return prg[addr-0x8000+2] }
+	assert.Equal(t, byte(0x11), at(0x8000))
+	assert.Equal(t, byte(0x12), at(0x87ff))
+	assert.Equal(t, byte(0x21), at(0x8800))
+	assert.Equal(t, byte(0x22), at(0x8be7))
+	assert.Equal(t, byte(0x31), at(0x8c00))
+	assert.Equal(t, byte(0x32), at(0x8fe7))
+	assert.Equal(t, byte(0x41), at(0x9000))
+	assert.Equal(t, byte(0x42), at(0x93e7))
+	assert.Equal(t, []byte{1, 2, 3, 4, 5}, prg[0x93e8-0x8000+2:][:5])
+	assert.Equal(t, byte(0x51), at(0xa000))
+	assert.Equal(t, byte(0x52), at(0xa000+7999))
+
+	// petscii uses the rom charset the vic sees at $9000 in bank 2.
+	s.CharsetType, s.Lowercase = petsciiCharset, 1
+	buf.Reset()
+	_, err = s.WriteTo(buf)
+	require.Nil(t, err)
+	assert.Equal(t, []byte{0x00, 0x88}, buf.Bytes()[:2])
+
+	type tc struct {
+		charsetType GraphicsType
+		lowercase   byte
+		want        map[string]int
+	}
+	testCases := []tc{
+		{multiColorCharset, 0, map[string]int{
+			"vicbank": 0x8000, "dd00": 1, "charset": 0x8000, "charsetscreenram": 0x8800, "bitmapscreenram": 0x8c00,
+			"colorram": 0x9000, "bitmap": 0xa000, "bitmapd018": 0x38, "charsetd018": 0x20, "charsetd016": 0x18,
+			"splitrasterline": 0x33 + 18*8,
+		}},
+		{petsciiCharset, 0, map[string]int{"dd00": 1, "charsetd018": 0x24, "charsetd016": 0x08}},
+		{petsciiCharset, 1, map[string]int{"dd00": 1, "charsetd018": 0x26}},
+	}
+	for _, c := range testCases {
+		s.CharsetType, s.Lowercase = c.charsetType, c.lowercase
+		got := map[string]int{}
+		for _, sym := range s.Symbols() {
+			got[sym.key] = sym.value
+		}
+		for k, v := range c.want {
+			assert.Equal(t, v, got[k], "%s %s", c.charsetType, k)
+		}
+		_, ok := got["charset"]
+		assert.Equal(t, c.charsetType != petsciiCharset, ok, c.charsetType)
+	}
+}
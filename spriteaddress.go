@@ -0,0 +1,168 @@
+package png2prg
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const VICBankSize = 0x4000
+
+// parseSpriteAddress parses the -sprite-address in hex ($3000 or 0x3000) or decimal notation.
+// The address must be 64 byte aligned to be usable as sprite pointer.
+func parseSpriteAddress(in string) (int, error) {
+	s, base := strings.TrimSpace(in), 10
+	switch {
+	case strings.HasPrefix(s, "$"):
+		s, base = s[1:], 16
+	case strings.HasPrefix(s, "0x"):
+		s, base = s[2:], 16
+	}
+	addr, err := strconv.ParseUint(s, base, 16)
+	if err != nil {
+		return 0, fmt.Errorf("strconv.ParseUint conversion of %q to address failed: %w", in, err)
+	}
+	if addr%64 != 0 {
+		return 0, fmt.Errorf("-sprite-address $%04x is not 64 byte aligned", addr)
+	}
+	return int(addr), nil
+}
+
+var spriteNameRegexp = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// LoadSpriteNames returns the sprite names of a .csv file (all fields in order) or a .yaml file (a list of names).
+// The names are used for the sprite pointer symbols, eg walk0 results in sprite_walk0.
+func LoadSpriteNames(path string) (names []string, err error) {
+	bin, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("os.ReadFile failed: %w", err)
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		if err = yaml.Unmarshal(bin, &names); err != nil {
+			return nil, fmt.Errorf("yaml.Unmarshal %q failed: %w", path, err)
+		}
+	case ".csv":
+		r := csv.NewReader(strings.NewReader(string(bin)))
+		r.FieldsPerRecord = -1
+		records, err := r.ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("csv.ReadAll %q failed: %w", path, err)
+		}
+		for _, record := range records {
+			for _, name := range record {
+				if name = strings.TrimSpace(name); name != "" {
+					names = append(names, name)
+				}
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported -sprite-names file %q, use .csv or .yaml", path)
+	}
+	seen := map[string]bool{}
+	for _, name := range names {
+		if !spriteNameRegexp.MatchString(name) {
+			return nil, fmt.Errorf("sprite name %q in %q is not a valid symbol, use letters, digits and _ only", name, path)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("sprite name %q is listed twice in %q", name, path)
+		}
+		seen[name] = true
+	}
+	return names, nil
+}
+
+// spriteAddress returns the load address of the sprites, BitmapAddress by default.
+func (o Options) spriteAddress() int {
+	if o.SpriteAddress == "" {
+		return BitmapAddress
+	}
+	return o.spriteAddr
+}
+
+// spriteHeader returns the startaddress of sprites located at the -sprite-address.
+func spriteHeader(opt Options) []byte {
+	addr := opt.spriteAddress()
+	return []byte{byte(addr & 0xff), byte(addr >> 8)}
+}
+
+// checkSpriteMemory validates that size bytes of sprite data fit in the vic bank of the -sprite-address, outside of the rom charset,
+// and that there are no more -sprite-names than the positions of sprites.
+// The tables after the sprites are only read by the cpu and not included in size.
+// The check is skipped without -sprite-address and -sprite-names.
+func checkSpriteMemory(opt Options, size, positions int) error {
+	if opt.SpriteAddress == "" && opt.SpriteNames == "" {
+		return nil
+	}
+	start := opt.spriteAddress()
+	end := start + size
+	bank := start &^ (VICBankSize - 1)
+	if end > bank+VICBankSize {
+		return fmt.Errorf("sprites $%04x-$%04x do not fit in vic bank $%04x-$%04x", start, end-1, bank, bank+VICBankSize-1)
+	}
+	if bank == 0x0000 || bank == 0x8000 {
+		// the vic sees the rom charset at $1000-$1fff in banks 0 and 2.
+		rom := bank + 0x1000
+		if start < rom+0x1000 && end > rom {
+			return fmt.Errorf("sprites $%04x-$%04x overlap the rom charset at $%04x-$%04x, which the vic sees instead", start, end-1, rom, rom+0xfff)
+		}
+	}
+	if len(opt.spriteNames) > positions {
+		return fmt.Errorf("found %d -sprite-names for %d sprites", len(opt.spriteNames), positions)
+	}
+	return nil
+}
+
+// spritePositions returns the number of sprite pointers, 1 per position in the index table of -sprite-dedup, -sprite-mirror and -sprite-trim,
+// otherwise 1 per sprite in bitmap.
+func spritePositions(opt Options, bitmap, index []byte) int {
+	if opt.SpriteDedup || opt.SpriteMirror || opt.SpriteTrim {
+		return len(index)
+	}
+	return len(bitmap) / 64
+}
+
+// spritePointerSymbols returns the vic bank and the sprite pointer of each sprite, named after -sprite-names or numbered.
+// With the index table of -sprite-dedup, -sprite-mirror and -sprite-trim, the pointers follow the index of each position,
+// empty sprites are skipped. A position showing a mirrored sprite points at the unmirrored sprite,
+// and gets an additional sprite_<name>_mirrored = 1 symbol, mirroring is left to the caller.
+// The pointers are only included with -sprite-address or -sprite-names.
+func spritePointerSymbols(opt Options, bitmap, index []byte) (syms []c64Symbol) {
+	if opt.Display || (opt.SpriteAddress == "" && opt.SpriteNames == "") {
+		return nil
+	}
+	if !opt.SpriteDedup && !opt.SpriteMirror && !opt.SpriteTrim {
+		index = nil
+	}
+	base := (opt.spriteAddress() & (VICBankSize - 1)) / 64
+	name := func(i int) string {
+		if i < len(opt.spriteNames) {
+			return "sprite_" + opt.spriteNames[i]
+		}
+		return "sprite_" + strconv.Itoa(i)
+	}
+	syms = append(syms, c64Symbol{"vicbank", opt.spriteAddress() &^ (VICBankSize - 1)})
+	if index == nil {
+		for i := 0; i < len(bitmap)/64; i++ {
+			syms = append(syms, c64Symbol{name(i), base + i})
+		}
+		return syms
+	}
+	for i, idx := range index {
+		if opt.SpriteTrim && idx == 0xff {
+			continue
+		}
+		if opt.SpriteMirror && idx&0x80 != 0 {
+			syms = append(syms, c64Symbol{name(i), base + int(idx&0x7f)}, c64Symbol{name(i) + "_mirrored", 1})
+			continue
+		}
+		syms = append(syms, c64Symbol{name(i), base + int(idx)})
+	}
+	return syms
+}
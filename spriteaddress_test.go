@@ -0,0 +1,121 @@
+package png2prg
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSpriteAddress(t *testing.T) {
+	t.Parallel()
+	type tc struct {
+		in      string
+		want    int
+		wantErr bool
+	}
+	testCases := []tc{
+		{"$3000", 0x3000, false},
+		{"0x8000", 0x8000, false},
+		{"8192", 0x2000, false},
+		{" $c040 ", 0xc040, false},
+		{"$3010", 0, true},
+		{"$10000", 0, true},
+		{"0xzz", 0, true},
+		{"", 0, true},
+	}
+	for _, c := range testCases {
+		got, err := parseSpriteAddress(c.in)
+		if c.wantErr {
+			assert.NotNil(t, err, c.in)
+			continue
+		}
+		assert.Nil(t, err, c.in)
+		assert.Equal(t, c.want, got, c.in)
+	}
+}
+
+func TestLoadSpriteNames(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	type tc struct {
+		name    string
+		content string
+		want    []string
+		wantErr bool
+	}
+	testCases := []tc{
+		{"names.csv", "walk0,walk1\n jump ,\nduck\n", []string{"walk0", "walk1", "jump", "duck"}, false},
+		{"names.yaml", "- walk0\n- walk1\n", []string{"walk0", "walk1"}, false},
+		{"names.yml", "- walk_0\n", []string{"walk_0"}, false},
+		{"twice.csv", "walk0,walk0\n", nil, true},
+		{"invalid.csv", "walk-0\n", nil, true},
+		{"invalid.yaml", "walk0: 1\n", nil, true},
+		{"names.txt", "walk0\n", nil, true},
+	}
+	for _, c := range testCases {
+		path := filepath.Join(dir, c.name)
+		require.Nil(t, os.WriteFile(path, []byte(c.content), 0o644))
+		got, err := LoadSpriteNames(path)
+		if c.wantErr {
+			assert.NotNil(t, err, c.name)
+			continue
+		}
+		assert.Nil(t, err, c.name)
+		assert.Equal(t, c.want, got, c.name)
+	}
+	_, err := LoadSpriteNames(filepath.Join(dir, "missing.csv"))
+	assert.NotNil(t, err)
+}
+
+func TestCheckSpriteMemory(t *testing.T) {
+	t.Parallel()
+	// 130 sprites at the default address exceed vic bank 0, which only matters for the sprite pointers.
+	assert.Nil(t, checkSpriteMemory(Options{}, 130*64, 130))
+	assert.NotNil(t, checkSpriteMemory(Options{SpriteNames: "names.csv"}, 130*64, 130))
+
+	opt := Options{SpriteAddress: "$c000", spriteAddr: 0xc000}
+	assert.Nil(t, checkSpriteMemory(opt, 256*64, 256))
+	assert.NotNil(t, checkSpriteMemory(opt, 257*64, 257))
+	opt.SpriteAddress, opt.spriteAddr = "$8800", 0x8800
+	assert.NotNil(t, checkSpriteMemory(opt, 33*64, 33))
+	assert.Nil(t, checkSpriteMemory(opt, 32*64, 32))
+	opt.spriteNames = []string{"a", "b"}
+	assert.NotNil(t, checkSpriteMemory(opt, 64, 1))
+}
+
+func TestSpritePointerSymbols(t *testing.T) {
+	t.Parallel()
+	bitmap := make([]byte, 3*64)
+	opt := Options{SpriteAddress: "$c000", spriteAddr: 0xc000, spriteNames: []string{"a", "b", "c", "d"}}
+	assert.Nil(t, spritePointerSymbols(Options{}, bitmap, nil))
+	assert.Equal(t, []c64Symbol{
+		{"vicbank", 0xc000},
+		{"sprite_a", 0},
+		{"sprite_b", 1},
+		{"sprite_c", 2},
+	}, spritePointerSymbols(opt, bitmap, nil))
+
+	// positions 0 and 3 show sprite 0, position 1 is trimmed and position 2 shows sprite 1 mirrored.
+	index := []byte{0x00, 0xff, 0x81, 0x00}
+	opt.SpriteMirror, opt.SpriteTrim = true, true
+	opt.SpriteAddress, opt.spriteAddr = "$2000", 0x2000
+	assert.Equal(t, []c64Symbol{
+		{"vicbank", 0},
+		{"sprite_a", 0x80},
+		{"sprite_c", 0x81},
+		{"sprite_c_mirrored", 1},
+		{"sprite_d", 0x80},
+	}, spritePointerSymbols(opt, bitmap[:2*64], index))
+
+	// without -sprite-mirror bit 7 is not a mirror flag.
+	opt.SpriteMirror, opt.SpriteTrim, opt.SpriteDedup = false, false, true
+	opt.spriteNames = nil
+	assert.Equal(t, []c64Symbol{
+		{"vicbank", 0},
+		{"sprite_0", 0x80},
+		{"sprite_1", 0x81},
+	}, spritePointerSymbols(opt, bitmap[:2*64], []byte{0, 1}))
+}
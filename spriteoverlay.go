@@ -0,0 +1,337 @@
+package png2prg
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// the overlay sprites end below the rom charset the vic sees at $1000, in the vic bank of the bitmap.
+	SpriteOverlayEndAddress = 0x1000
+	MaxOverlaySprites       = (SpriteOverlayEndAddress - 0x0800) / 64
+	// the position and color tables are only read by the cpu and follow the bitmap data.
+	KoalaSpriteOverlayTablesAddress = 0x4740
+	HiresSpriteOverlayTablesAddress = 0x4340
+	MaxSpritesPerLine               = 8
+)
+
+// A SpriteOverlay contains singlecolor sprites on top of a koala or hires bitmap,
+// for the colors that exceed the limit of colors per char, see -sprite-overlay.
+// The positions are in hardware sprite coordinates, to use in $d000-$d010.
+type SpriteOverlay struct {
+	Sprites []byte // 64 bytes per sprite, with the color in the 64th byte
+	XLo     []byte
+	XHi     []byte // bit 8 of x
+	Y       []byte
+	Colors  []byte
+	tables  int
+}
+
+// empty returns true if o is nil or contains no sprites.
+func (o *SpriteOverlay) empty() bool {
+	return o == nil || len(o.Colors) == 0
+}
+
+// address returns the start address of the sprites, which end at SpriteOverlayEndAddress.
+func (o *SpriteOverlay) address() int {
+	return SpriteOverlayEndAddress - len(o.Sprites)
+}
+
+// linkMap returns the sprites and the XLo, XHi, Y and Colors tables of o.
+func (o *SpriteOverlay) linkMap() LinkMap {
+	n := len(o.Colors)
+	return LinkMap{
+		Word(o.address()):    o.Sprites,
+		Word(o.tables):       o.XLo,
+		Word(o.tables + n):   o.XHi,
+		Word(o.tables + 2*n): o.Y,
+		Word(o.tables + 3*n): o.Colors,
+	}
+}
+
+// Symbols returns the addresses of the overlay sprites and tables, the sprite pointer of the first sprite is overlaypointer.
+// An empty overlay has no symbols.
+func (o *SpriteOverlay) Symbols() []c64Symbol {
+	if o.empty() {
+		return nil
+	}
+	n := len(o.Colors)
+	return []c64Symbol{
+		{"overlaysprites", o.address()},
+		{"numoverlaysprites", n},
+		{"vicbank", o.address() &^ (VICBankSize - 1)},
+		{"overlaypointer", (o.address() & (VICBankSize - 1)) / 64},
+		{"overlayxlo", o.tables},
+		{"overlayxhi", o.tables + n},
+		{"overlayy", o.tables + 2*n},
+		{"overlaycolors", o.tables + 3*n},
+	}
+}
+
+// overlayChars returns a copy of img where, for each char, the colors exceeding the limit of gfxtype are moved to a mask.
+// The least used colors of a char are moved first, for koala the background color bg is always kept.
+// Masked pixels are replaced by the background color or the most used color of the char,
+// for koala by the other pixel of the pair if possible.
+// For koala, the less used color of each pair of pixels with different colors is also moved to the mask.
+func (img *sourceImage) overlayChars(gfxtype GraphicsType, bg C64Color) (out *image.RGBA, mask [FullScreenHeight][FullScreenWidth]int, err error) {
+	maxColors, keepBg := 4, true
+	if gfxtype == singleColorBitmap {
+		maxColors, keepBg = 2, false
+	}
+	out = image.NewRGBA(image.Rect(0, 0, FullScreenWidth, FullScreenHeight))
+	for char := 0; char < FullScreenChars; char++ {
+		x0, y0 := xyFromChar(char)
+		count := map[C64Color]int{}
+		for y := y0; y < y0+8; y++ {
+			for x := x0; x < x0+8; x++ {
+				col, err := img.p.FromColor(img.At(x, y))
+				if err != nil {
+					return nil, mask, fmt.Errorf("img.p.FromColor failed: %w", err)
+				}
+				count[col.C64Color]++
+				mask[y][x] = -1
+				out.Set(x, y, img.At(x, y))
+			}
+		}
+		keep := maxColors
+		if keepBg && count[bg] == 0 {
+			// the background color is needed by the char, even if it does not use it.
+			keep--
+		}
+		cc := make([]C64Color, 0, len(count))
+		for col := range count {
+			cc = append(cc, col)
+		}
+		sort.Slice(cc, func(i, j int) bool {
+			switch {
+			case keepBg && cc[i] == bg:
+				return true
+			case keepBg && cc[j] == bg:
+				return false
+			case count[cc[i]] == count[cc[j]]:
+				return cc[i] < cc[j]
+			}
+			return count[cc[i]] > count[cc[j]]
+		})
+		fill := img.p.FromC64NoErr(cc[0])
+		excess := map[C64Color]bool{}
+		if len(cc) > keep {
+			for _, col := range cc[keep:] {
+				excess[col] = true
+			}
+			if img.opt.Verbose {
+				log.Printf("char %d (x=%d y=%d) moves colors %v to the sprite overlay", char, x0, y0, cc[keep:])
+			}
+		}
+		for y := y0; y < y0+8; y++ {
+			for x := x0; x < x0+8; x++ {
+				col := img.p.FromColorNoErr(img.At(x, y)).C64Color
+				if !excess[col] {
+					continue
+				}
+				mask[y][x] = int(col)
+				out.Set(x, y, fill)
+				if gfxtype == multiColorBitmap {
+					// keep the pair of pixels intact for koala.
+					if other := img.p.FromColorNoErr(img.At(x^1, y)); !excess[other.C64Color] {
+						out.Set(x, y, other)
+					}
+				}
+			}
+			if gfxtype != multiColorBitmap {
+				continue
+			}
+			for x := x0; x < x0+8; x += 2 {
+				if mask[y][x] >= 0 || mask[y][x+1] >= 0 {
+					continue
+				}
+				a, b := img.p.FromColorNoErr(img.At(x, y)), img.p.FromColorNoErr(img.At(x+1, y))
+				switch {
+				case a.C64Color == b.C64Color:
+				case count[a.C64Color] < count[b.C64Color]:
+					mask[y][x] = int(a.C64Color)
+					out.Set(x, y, b)
+				default:
+					mask[y][x+1] = int(b.C64Color)
+					out.Set(x+1, y, a)
+				}
+			}
+		}
+	}
+	return out, mask, nil
+}
+
+// overlaySprites covers the masked pixels with singlecolor sprites, 1 color per sprite, from top to bottom.
+// Returns the lines that show more than MaxSpritesPerLine sprites.
+func overlaySprites(mask [FullScreenHeight][FullScreenWidth]int) (o *SpriteOverlay, lines []int) {
+	o = &SpriteOverlay{}
+	var perLine [FullScreenHeight]int
+	for y := 0; y < FullScreenHeight; y++ {
+		for x := 0; x < FullScreenWidth; x++ {
+			col := mask[y][x]
+			if col < 0 {
+				continue
+			}
+			// start at the leftmost pixel of this color that fits in the same sprite.
+			x0 := x
+			for y2 := y; y2 < y+SpriteHeight && y2 < FullScreenHeight; y2++ {
+				for x2 := x - SpriteWidth + 1; x2 < x0; x2++ {
+					if x2 >= 0 && mask[y2][x2] == col {
+						x0 = x2
+					}
+				}
+			}
+			sprite := make([]byte, 64)
+			for sy := 0; sy < SpriteHeight && y+sy < FullScreenHeight; sy++ {
+				for sx := 0; sx < SpriteWidth && x0+sx < FullScreenWidth; sx++ {
+					if mask[y+sy][x0+sx] == col {
+						sprite[sy*3+sx/8] |= 0x80 >> byte(sx%8)
+						mask[y+sy][x0+sx] = -1
+					}
+				}
+				perLine[y+sy]++
+			}
+			// SpritePad convention: individual color in the low nibble of the 64th byte.
+			sprite[63] = byte(col)
+			o.Sprites = append(o.Sprites, sprite...)
+			hx, hy := x0+24, y+50
+			o.XLo = append(o.XLo, byte(hx))
+			o.XHi = append(o.XHi, byte(hx>>8))
+			o.Y = append(o.Y, byte(hy))
+			o.Colors = append(o.Colors, byte(col))
+		}
+	}
+	for y, n := range perLine {
+		if n > MaxSpritesPerLine {
+			lines = append(lines, y)
+		}
+	}
+	return o, lines
+}
+
+// formatLineRanges returns the sorted lines as comma separated ranges, eg 40-60,112.
+func formatLineRanges(lines []int) string {
+	var ranges []string
+	for i := 0; i < len(lines); {
+		j := i
+		for j+1 < len(lines) && lines[j+1] == lines[j]+1 {
+			j++
+		}
+		if i == j {
+			ranges = append(ranges, strconv.Itoa(lines[i]))
+		} else {
+			ranges = append(ranges, fmt.Sprintf("%d-%d", lines[i], lines[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(ranges, ",")
+}
+
+// WriteSpriteOverlayTo converts the image to a koala or hires bitmap, moving the colors that exceed the limit per char to a sprite overlay.
+func (c *Converter) WriteSpriteOverlayTo(w io.Writer) (n int64, err error) {
+	if len(c.images) != 1 {
+		return n, fmt.Errorf("-sprite-overlay requires exactly 1 image, not %d", len(c.images))
+	}
+	if c.opt.Display {
+		return n, fmt.Errorf("-sprite-overlay has no displayer support")
+	}
+	img := &c.images[0]
+	if img.width != FullScreenWidth || img.height != FullScreenHeight {
+		return n, fmt.Errorf("-sprite-overlay requires a %dx%d image, not %dx%d", FullScreenWidth, FullScreenHeight, img.width, img.height)
+	}
+	gfxtype := multiColorBitmap
+	if c.opt.GraphicsMode != "" {
+		gfxtype = c.opt.CurrentGraphicsType
+	}
+	forceBorder := true
+	if err = img.findBorderColor(); err != nil {
+		forceBorder = false
+		if c.opt.Verbose {
+			log.Printf("skipping: findBorderColor failed: %v", err)
+		}
+	}
+	// img.makeCharColors fails on chars with too many colors, the background color is used by most chars.
+	bg := C64Color(0)
+	if len(img.bpc) > 0 && img.bpc[0] != nil {
+		bg = img.bpc[0].C64Color
+	} else {
+		sumColors := [MaxColors]int{}
+		for char := 0; char < FullScreenChars; char++ {
+			for _, col := range img.colorsFromChar(char) {
+				sumColors[col.C64Color]++
+			}
+		}
+		for col := range sumColors {
+			if sumColors[col] > sumColors[bg] {
+				bg = C64Color(col)
+			}
+		}
+	}
+
+	opt := c.opt
+	opt.GraphicsMode, opt.CurrentGraphicsType = gfxtype.String(), gfxtype
+	if forceBorder {
+		opt.ForceBorderColor = int(img.border.C64Color)
+	}
+	opt.SpriteOverlay = false
+	if gfxtype == multiColorBitmap && opt.BitpairColorsString == "" {
+		opt.BitpairColorsString = strconv.Itoa(int(bg))
+	}
+	rgba, mask, err := img.overlayChars(gfxtype, bg)
+	if err != nil {
+		return n, fmt.Errorf("img.overlayChars failed: %w", err)
+	}
+	overlay, lines := overlaySprites(mask)
+	if len(overlay.Colors) > MaxOverlaySprites {
+		return n, fmt.Errorf("-sprite-overlay needs %d sprites, only %d fit in $%04x-$%04x", len(overlay.Colors), MaxOverlaySprites, SpriteOverlayEndAddress-64*MaxOverlaySprites, SpriteOverlayEndAddress-1)
+	}
+	if len(lines) > 0 && !c.opt.Quiet {
+		fmt.Printf("warning: more than %d sprites on lines %s\n", MaxSpritesPerLine, formatLineRanges(lines))
+	}
+	if !c.opt.Quiet {
+		fmt.Printf("moved excess colors to %d overlay sprites\n", len(overlay.Colors))
+	}
+
+	ri, err := NewSourceImage(opt, 0, rgba)
+	if err != nil {
+		return n, fmt.Errorf("NewSourceImage %q failed: %w", img.sourceFilename, err)
+	}
+	ri.sourceFilename = img.sourceFilename
+	if err = ri.analyze(); err != nil {
+		return n, fmt.Errorf("analyze %q failed: %w", ri.sourceFilename, err)
+	}
+	img.graphicsType = gfxtype
+	var wt interface {
+		io.WriterTo
+		Symbolser
+	}
+	switch gfxtype {
+	case multiColorBitmap:
+		k, err := ri.Koala()
+		if err != nil {
+			return n, fmt.Errorf("ri.Koala %q failed: %w", ri.sourceFilename, err)
+		}
+		overlay.tables = KoalaSpriteOverlayTablesAddress
+		k.Overlay = overlay
+		wt = k
+	case singleColorBitmap:
+		h, err := ri.Hires()
+		if err != nil {
+			return n, fmt.Errorf("ri.Hires %q failed: %w", ri.sourceFilename, err)
+		}
+		overlay.tables = HiresSpriteOverlayTablesAddress
+		h.Overlay = overlay
+		wt = h
+	default:
+		return n, fmt.Errorf("-sprite-overlay only supports koala and hires, not %s", gfxtype)
+	}
+	if c.opt.Symbols {
+		c.Symbols = append(c.Symbols, wt.Symbols()...)
+	}
+	return wt.WriteTo(w)
+}
@@ -0,0 +1,138 @@
+package png2prg
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatLineRanges(t *testing.T) {
+	t.Parallel()
+	type tc struct {
+		lines []int
+		want  string
+	}
+	testCases := []tc{
+		{nil, ""},
+		{[]int{7}, "7"},
+		{[]int{7, 8}, "7-8"},
+		{[]int{7, 9}, "7,9"},
+		{[]int{40, 41, 42, 60, 112, 113}, "40-42,60,112-113"},
+	}
+	for _, c := range testCases {
+		assert.Equal(t, c.want, formatLineRanges(c.lines), c.lines)
+	}
+}
+
+func TestSpriteOverlayLinkMap(t *testing.T) {
+	t.Parallel()
+	o := &SpriteOverlay{
+		Sprites: make([]byte, 2*64),
+		XLo:     []byte{1, 2},
+		XHi:     []byte{0, 1},
+		Y:       []byte{3, 4},
+		Colors:  []byte{5, 6},
+		tables:  KoalaSpriteOverlayTablesAddress,
+	}
+	m := o.linkMap()
+	assert.Equal(t, o.Sprites, m[0x0f80])
+	assert.Equal(t, o.Colors, m[KoalaSpriteOverlayTablesAddress+6])
+	want := map[string]int{
+		"overlaysprites":    0x0f80,
+		"numoverlaysprites": 2,
+		"vicbank":           0x0000,
+		"overlaypointer":    0x3e,
+		"overlayxlo":        0x4740,
+		"overlayxhi":        0x4742,
+	}
+	for _, s := range o.Symbols() {
+		if v, ok := want[s.key]; ok {
+			assert.Equal(t, v, s.value, s.key)
+		}
+	}
+}
+
+func TestOverlayKoalaChar(t *testing.T) {
+	t.Parallel()
+	rgb := map[C64Color]color.RGBA{
+		0: {0x00, 0x00, 0x00, 0xff},
+		1: {0xff, 0xff, 0xff, 0xff},
+		2: {0xb5, 0x61, 0x48, 0xff},
+		5: {0x79, 0xd5, 0x70, 0xff},
+		6: {0x60, 0x49, 0xed, 0xff},
+	}
+	// the first char uses 5 colors, 6 is the least used.
+	// the pair of 1 and 2 on the last line needs the mask for the less used color 2.
+	char := [8]string{
+		"11111111",
+		"11111111",
+		"22222222",
+		"22220000",
+		"55555555",
+		"60000000",
+		"00660000",
+		"00001200",
+	}
+	im := image.NewRGBA(image.Rect(0, 0, FullScreenWidth, FullScreenHeight))
+	for y := 0; y < FullScreenHeight; y++ {
+		for x := 0; x < FullScreenWidth; x++ {
+			col := C64Color(0)
+			if x < 8 && y < 8 {
+				col = C64Color(char[y][x] - '0')
+			}
+			im.Set(x, y, rgb[col])
+		}
+	}
+	img, err := NewSourceImage(Options{Quiet: true}, 0, im)
+	require.Nil(t, err)
+
+	out, mask, err := img.overlayChars(multiColorBitmap, 0)
+	require.Nil(t, err)
+	want := map[[2]int]int{{0, 5}: 6, {2, 6}: 6, {3, 6}: 6, {5, 7}: 2}
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			col, ok := want[[2]int{x, y}]
+			if !ok {
+				col = -1
+			}
+			assert.Equal(t, col, mask[y][x], "x=%d y=%d", x, y)
+		}
+	}
+	// masked pixels take the other pixel of the pair, or the background color.
+	assert.Equal(t, rgb[0], out.RGBAAt(0, 5))
+	assert.Equal(t, rgb[0], out.RGBAAt(2, 6))
+	assert.Equal(t, rgb[1], out.RGBAAt(5, 7))
+	assert.Equal(t, rgb[5], out.RGBAAt(0, 4))
+
+	o, lines := overlaySprites(mask)
+	assert.Nil(t, lines)
+	require.Len(t, o.Sprites, 2*64)
+	assert.Equal(t, byte(0x80), o.Sprites[0])
+	assert.Equal(t, byte(0x30), o.Sprites[3])
+	assert.Equal(t, byte(6), o.Sprites[63])
+	assert.Equal(t, byte(0x80), o.Sprites[64])
+	assert.Equal(t, byte(2), o.Sprites[64+63])
+	for i, b := range o.Sprites {
+		if i != 0 && i != 3 && i != 63 && i != 64 && i != 64+63 {
+			assert.Equal(t, byte(0), b, i)
+		}
+	}
+	assert.Equal(t, []byte{24, 29}, o.XLo)
+	assert.Equal(t, []byte{0, 0}, o.XHi)
+	assert.Equal(t, []byte{55, 57}, o.Y)
+	assert.Equal(t, []byte{6, 2}, o.Colors)
+
+	// without excess colors the overlay is empty and has no symbols.
+	for y := range mask {
+		for x := range mask[y] {
+			mask[y][x] = -1
+		}
+	}
+	o, _ = overlaySprites(mask)
+	o.tables = KoalaSpriteOverlayTablesAddress
+	assert.True(t, o.empty())
+	assert.Nil(t, o.Symbols())
+}
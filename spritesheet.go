@@ -0,0 +1,383 @@
+package png2prg
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"strconv"
+	"strings"
+)
+
+// A spriteSheet describes the layout of the sprites in a sheet image.
+// Sprites are read from rect, starting margin pixels from its top left corner,
+// with spacing pixels between the cells, eg for sheets with 1 pixel grid lines.
+// Objects of objectWidth x objectHeight sprites are stored consecutively, left to right and top to bottom.
+// The cells are cellWidth x cellHeight pixels, doubled for expanded sprites.
+type spriteSheet struct {
+	rect         image.Rectangle
+	cellWidth    int
+	cellHeight   int
+	margin       int
+	spacing      int
+	columnMajor  bool
+	objectWidth  int
+	objectHeight int
+}
+
+// parseSpriteSheet returns the spriteSheet of the -sprite-* options, or nil if the default tightly packed layout is used.
+func parseSpriteSheet(opt Options) (*spriteSheet, error) {
+	if opt.SpriteMargin == 0 && opt.SpriteSpacing == 0 && !opt.SpriteColumnMajor && opt.SpriteRect == "" && opt.SpriteObjects == "" {
+		return nil, nil
+	}
+	if opt.SpriteMargin < 0 || opt.SpriteSpacing < 0 {
+		return nil, fmt.Errorf("-sprite-margin %d and -sprite-spacing %d can not be negative", opt.SpriteMargin, opt.SpriteSpacing)
+	}
+	e, err := parseSpriteExpansion(opt)
+	if err != nil {
+		return nil, fmt.Errorf("parseSpriteExpansion failed: %w", err)
+	}
+	xf, yf := e.factors()
+	s := &spriteSheet{
+		cellWidth:    SpriteWidth * xf,
+		cellHeight:   SpriteHeight * yf,
+		margin:       opt.SpriteMargin,
+		spacing:      opt.SpriteSpacing,
+		columnMajor:  opt.SpriteColumnMajor,
+		objectWidth:  1,
+		objectHeight: 1,
+	}
+	if opt.SpriteRect != "" {
+		var v []int
+		for _, f := range strings.Split(opt.SpriteRect, ",") {
+			i, err := strconv.Atoi(strings.TrimSpace(f))
+			if err != nil {
+				return nil, fmt.Errorf("strconv.Atoi conversion of %q to integer failed: %w", f, err)
+			}
+			v = append(v, i)
+		}
+		if len(v) != 4 || v[0] < 0 || v[1] < 0 || v[2] < 1 || v[3] < 1 {
+			return nil, fmt.Errorf("incorrect -sprite-rect %q, use x,y,width,height in pixels", opt.SpriteRect)
+		}
+		s.rect = image.Rect(v[0], v[1], v[0]+v[2], v[1]+v[3])
+	}
+	if opt.SpriteObjects != "" {
+		a, b, ok := strings.Cut(opt.SpriteObjects, "x")
+		if !ok {
+			return nil, fmt.Errorf("incorrect -sprite-objects %q, use wxh sprites, eg 2x2", opt.SpriteObjects)
+		}
+		if s.objectWidth, err = strconv.Atoi(a); err != nil {
+			return nil, fmt.Errorf("strconv.Atoi conversion of %q to integer failed: %w", a, err)
+		}
+		if s.objectHeight, err = strconv.Atoi(b); err != nil {
+			return nil, fmt.Errorf("strconv.Atoi conversion of %q to integer failed: %w", b, err)
+		}
+		if s.objectWidth < 1 || s.objectHeight < 1 {
+			return nil, fmt.Errorf("incorrect -sprite-objects %q, use wxh sprites, eg 2x2", opt.SpriteObjects)
+		}
+	}
+	return s, nil
+}
+
+// cells returns the top left pixel positions of the sprites in im, in output order,
+// and the number of sprite columns and rows in the sheet.
+func (s *spriteSheet) cells(im image.Image) (cells []image.Point, cols, rows int, err error) {
+	r := im.Bounds()
+	if !s.rect.Empty() {
+		r = s.rect.Add(im.Bounds().Min)
+		if !r.In(im.Bounds()) {
+			return nil, 0, 0, fmt.Errorf("-sprite-rect %v is outside of the %dx%d image", s.rect, im.Bounds().Dx(), im.Bounds().Dy())
+		}
+	}
+	cols = (r.Dx() - s.margin + s.spacing) / (s.cellWidth + s.spacing)
+	rows = (r.Dy() - s.margin + s.spacing) / (s.cellHeight + s.spacing)
+	if cols < 1 || rows < 1 {
+		return nil, 0, 0, fmt.Errorf("no sprites found in the %dx%d sheet with -sprite-margin %d and -sprite-spacing %d", r.Dx(), r.Dy(), s.margin, s.spacing)
+	}
+	if cols%s.objectWidth != 0 || rows%s.objectHeight != 0 {
+		return nil, 0, 0, fmt.Errorf("the sheet of %d x %d sprites can not be divided in objects of %d x %d sprites", cols, rows, s.objectWidth, s.objectHeight)
+	}
+	objCols, objRows := cols/s.objectWidth, rows/s.objectHeight
+	for i := 0; i < objCols*objRows; i++ {
+		ox, oy := i%objCols, i/objCols
+		if s.columnMajor {
+			ox, oy = i/objRows, i%objRows
+		}
+		for j := 0; j < s.objectWidth*s.objectHeight; j++ {
+			cx := ox*s.objectWidth + j%s.objectWidth
+			cy := oy*s.objectHeight + j/s.objectWidth
+			cells = append(cells, image.Pt(r.Min.X+s.margin+cx*(s.cellWidth+s.spacing), r.Min.Y+s.margin+cy*(s.cellHeight+s.spacing)))
+		}
+	}
+	return cells, cols, rows, nil
+}
+
+// layout returns the sprites of the sheet im as tightly packed image of the same number of columns and rows,
+// with the sprites in output order from left to right and top to bottom.
+func (s *spriteSheet) layout(im image.Image) (image.Image, error) {
+	cells, cols, rows, err := s.cells(im)
+	if err != nil {
+		return nil, err
+	}
+	out := image.NewRGBA(image.Rect(0, 0, cols*s.cellWidth, rows*s.cellHeight))
+	for i, p := range cells {
+		dst := image.Rect(0, 0, s.cellWidth, s.cellHeight).Add(image.Pt((i%cols)*s.cellWidth, (i/cols)*s.cellHeight))
+		draw.Draw(out, dst, im, p, draw.Src)
+	}
+	return out, nil
+}
+
+// spriteObjects returns the object size in sprites, according to -sprite-objects.
+// The sprites of each object are stored consecutively by layout, so sprite n*w*h is the first sprite of object n.
+func spriteObjects(opt Options) (w, h byte, err error) {
+	s, err := parseSpriteSheet(opt)
+	if err != nil {
+		return 0, 0, fmt.Errorf("parseSpriteSheet failed: %w", err)
+	}
+	if s == nil {
+		return 1, 1, nil
+	}
+	return byte(s.objectWidth), byte(s.objectHeight), nil
+}
+
+// dedupSprites stores the empty (-sprite-trim) and identical or mirrored (-sprite-dedup, -sprite-mirror) sprites of bitmap only once.
+// It returns the stored sprites, their colors and the index table, mapping each sprite of bitmap to the stored sprite.
+// In the index table, bit 7 is set for mirrored sprites and $ff marks empty sprites.
+// Without these options, the input is returned as is.
+func dedupSprites(opt Options, bitmap, colors []byte) (stored, storedColors, index []byte, err error) {
+	if !opt.SpriteDedup && !opt.SpriteMirror && !opt.SpriteTrim {
+		return bitmap, colors, nil, nil
+	}
+	if opt.Display {
+		return nil, nil, nil, fmt.Errorf("-sprite-dedup, -sprite-mirror and -sprite-trim have no displayer support")
+	}
+	numSprites := len(bitmap) / 64
+	if numSprites > 256 {
+		return nil, nil, nil, fmt.Errorf("the sprite index table supports max 256 sprites, not %d", numSprites)
+	}
+	maxStored := 255
+	if opt.SpriteMirror {
+		maxStored = 127
+	}
+	index = make([]byte, numSprites)
+	for i := 0; i < numSprites; i++ {
+		sprite := bitmap[i*64 : i*64+64]
+		if opt.SpriteTrim && isEmptySprite(sprite) {
+			index[i] = 0xff
+			continue
+		}
+		index[i] = byte(len(stored) / 64)
+		if opt.SpriteDedup || opt.SpriteMirror {
+			mirrored := mirrorSprite(sprite)
+			for j := 0; j < len(stored)/64; j++ {
+				s := stored[j*64 : j*64+64]
+				if bytes.Equal(s, sprite) {
+					index[i] = byte(j)
+					break
+				}
+				if opt.SpriteMirror && bytes.Equal(s, mirrored) {
+					index[i] = 0x80 | byte(j)
+					break
+				}
+			}
+		}
+		if int(index[i]) == len(stored)/64 {
+			if len(stored)/64 == maxStored {
+				return nil, nil, nil, fmt.Errorf("more than %d unique sprites can not be stored in the sprite index table", maxStored)
+			}
+			stored = append(stored, sprite...)
+			if len(colors) > 0 {
+				storedColors = append(storedColors, colors[i])
+			}
+		}
+	}
+	if !opt.Quiet {
+		fmt.Printf("stored %d of %d sprites\n", len(stored)/64, numSprites)
+	}
+	return stored, storedColors, index, nil
+}
+
+// isEmptySprite returns true if the sprite has no pixels set.
+func isEmptySprite(sprite []byte) bool {
+	for _, b := range sprite[:63] {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// mirrorSprite returns the horizontally mirrored sprite, using bitpairs for multicolor sprites.
+// The 64th byte is kept as is.
+func mirrorSprite(sprite []byte) []byte {
+	bits := 1
+	if sprite[63]&0x80 != 0 {
+		bits = 2
+	}
+	mask := uint32(1)<<bits - 1
+	out := make([]byte, 64)
+	out[63] = sprite[63]
+	for y := 0; y < SpriteHeight; y++ {
+		row := uint32(sprite[y*3])<<16 | uint32(sprite[y*3+1])<<8 | uint32(sprite[y*3+2])
+		mirrored := uint32(0)
+		for x := 0; x < SpriteWidth; x += bits {
+			mirrored = mirrored<<bits | (row>>x)&mask
+		}
+		out[y*3], out[y*3+1], out[y*3+2] = byte(mirrored>>16), byte(mirrored>>8), byte(mirrored)
+	}
+	return out
+}
+
+// spriteTableSymbols returns the symbols of the color and index tables, stored after the sprites in bitmap,
+// and the object size of -sprite-objects.
+// The tables are not included with the displayer.
+func spriteTableSymbols(opt Options, bitmap, colors, index []byte, w, h byte) (syms []c64Symbol) {
+	if opt.Display {
+		return nil
+	}
+	if len(colors) > 0 {
+		syms = append(syms, c64Symbol{"spritecolors", opt.spriteAddress() + len(bitmap)})
+	}
+	if len(index) > 0 {
+		syms = append(syms, c64Symbol{"spriteindex", opt.spriteAddress() + len(bitmap) + len(colors)})
+	}
+	if int(w)*int(h) > 1 {
+		syms = append(syms,
+			c64Symbol{"numobjects", spritePositions(opt, bitmap, index) / (int(w) * int(h))},
+			c64Symbol{"objectwidth", int(w)},
+			c64Symbol{"objectheight", int(h)},
+		)
+	}
+	return append(syms, spritePointerSymbols(opt, bitmap, index)...)
+}
+
+// A spriteExpansion describes the x and/or y expansion of the sprites in the source image, see -sprite-expand.
+// Expanded sprites are drawn with doubled pixels and reduced to native 24x21 sprites.
+type spriteExpansion struct {
+	x    bool
+	y    bool
+	auto bool
+}
+
+// parseSpriteExpansion returns the spriteExpansion of -sprite-expand, none by default.
+func parseSpriteExpansion(opt Options) (spriteExpansion, error) {
+	switch opt.SpriteExpand {
+	case "auto":
+		return spriteExpansion{auto: true}, nil
+	case "", "none":
+		return spriteExpansion{}, nil
+	case "x":
+		return spriteExpansion{x: true}, nil
+	case "y":
+		return spriteExpansion{y: true}, nil
+	case "xy":
+		return spriteExpansion{x: true, y: true}, nil
+	}
+	return spriteExpansion{}, fmt.Errorf("incorrect -sprite-expand %q, use auto, none, x, y or xy", opt.SpriteExpand)
+}
+
+func (e spriteExpansion) String() string {
+	switch {
+	case e.x && e.y:
+		return "xy"
+	case e.x:
+		return "x"
+	case e.y:
+		return "y"
+	}
+	return "none"
+}
+
+// factors returns the width and height of an expanded sprite pixel.
+func (e spriteExpansion) factors() (x, y int) {
+	x, y = 1, 1
+	if e.x {
+		x = 2
+	}
+	if e.y {
+		y = 2
+	}
+	return x, y
+}
+
+// detectSpriteExpansion returns the expansion of the sprites in im.
+// Rows are y expanded if each pair of rows is identical.
+// Sprites are x expanded if each 4 pixels are identical, or each 2 pixels with -mode scsprites,
+// as x expanded singlecolor sprites can not be told apart from multicolor sprites otherwise.
+func detectSpriteExpansion(opt Options, im image.Image) (e spriteExpansion) {
+	if opt.GraphicsMode != "" && !opt.CurrentGraphicsType.isSprites() {
+		return spriteExpansion{}
+	}
+	pixelWidth := 4
+	if opt.GraphicsMode != "" && opt.CurrentGraphicsType == singleColorSprites {
+		pixelWidth = 2
+	}
+	w, h := im.Bounds().Dx(), im.Bounds().Dy()
+	if w%SpriteWidth != 0 || h%SpriteHeight != 0 {
+		return spriteExpansion{}
+	}
+	if h%(2*SpriteHeight) == 0 {
+		_, e.y = firstUnexpandedPixel(im, 1, 2)
+		e.y = !e.y
+	}
+	if w%(2*SpriteWidth) == 0 {
+		_, e.x = firstUnexpandedPixel(im, pixelWidth, 1)
+		e.x = !e.x
+	}
+	if !opt.Quiet && (e.x || e.y) {
+		fmt.Printf("expanded sprites found: %s\n", e)
+	}
+	return e
+}
+
+// apply returns im with the expanded sprite pixels reduced to native sprite pixels and the expansion that was applied.
+// Returns error if the pixels of im are not expanded.
+func (e spriteExpansion) apply(opt Options, im image.Image) (image.Image, spriteExpansion, error) {
+	if e.auto {
+		e = detectSpriteExpansion(opt, im)
+	}
+	if !e.x && !e.y {
+		return im, e, nil
+	}
+	xf, yf := e.factors()
+	r := im.Bounds()
+	if r.Dx()%(SpriteWidth*xf) != 0 || r.Dy()%(SpriteHeight*yf) != 0 {
+		return nil, e, fmt.Errorf("the %dx%d image is not a multiple of %dx%d pixel %s expanded sprites", r.Dx(), r.Dy(), SpriteWidth*xf, SpriteHeight*yf, e)
+	}
+	if p, found := firstUnexpandedPixel(im, xf, yf); found {
+		return nil, e, fmt.Errorf("pixel at x=%d y=%d is not %s expanded", p.X, p.Y, e)
+	}
+	out := image.NewRGBA(image.Rect(0, 0, r.Dx()/xf, r.Dy()/yf))
+	for y := 0; y < out.Bounds().Dy(); y++ {
+		for x := 0; x < out.Bounds().Dx(); x++ {
+			out.Set(x, y, im.At(r.Min.X+x*xf, r.Min.Y+y*yf))
+		}
+	}
+	return out, e, nil
+}
+
+// firstUnexpandedPixel returns the position of the first pixel in im that differs from the top left pixel of its w x h block.
+func firstUnexpandedPixel(im image.Image, w, h int) (p image.Point, found bool) {
+	r := im.Bounds()
+	for y := 0; y < r.Dy(); y++ {
+		for x := 0; x < r.Dx(); x++ {
+			a, b := im.At(r.Min.X+x, r.Min.Y+y), im.At(r.Min.X+x-x%w, r.Min.Y+y-y%h)
+			if color.RGBAModel.Convert(a) != color.RGBAModel.Convert(b) {
+				return image.Pt(x, y), true
+			}
+		}
+	}
+	return image.Point{}, false
+}
+
+// spriteExpansionSymbols returns the expandx and expandy symbols of expanded sprites, to set in $d01d and $d017.
+func spriteExpansionSymbols(x, y bool) (syms []c64Symbol) {
+	if x {
+		syms = append(syms, c64Symbol{"expandx", 1})
+	}
+	if y {
+		syms = append(syms, c64Symbol{"expandy", 1})
+	}
+	return syms
+}
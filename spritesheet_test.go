@@ -0,0 +1,200 @@
+package png2prg
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSpriteExpansion(t *testing.T) {
+	t.Parallel()
+	type tc struct {
+		in      string
+		want    spriteExpansion
+		wantErr bool
+	}
+	testCases := []tc{
+		{"", spriteExpansion{}, false},
+		{"none", spriteExpansion{}, false},
+		{"auto", spriteExpansion{auto: true}, false},
+		{"x", spriteExpansion{x: true}, false},
+		{"y", spriteExpansion{y: true}, false},
+		{"xy", spriteExpansion{x: true, y: true}, false},
+		{"yx", spriteExpansion{}, true},
+	}
+	for _, c := range testCases {
+		got, err := parseSpriteExpansion(Options{SpriteExpand: c.in})
+		if c.wantErr {
+			assert.NotNil(t, err, c.in)
+			continue
+		}
+		assert.Nil(t, err, c.in)
+		assert.Equal(t, c.want, got, c.in)
+	}
+}
+
+func TestDetectSpriteExpansion(t *testing.T) {
+	t.Parallel()
+	// a 48x21 sprite with pixels that are 2 wide.
+	im := image.NewRGBA(image.Rect(0, 0, 2*SpriteWidth, SpriteHeight))
+	for y := 0; y < SpriteHeight; y++ {
+		for x := 0; x < 2*SpriteWidth; x++ {
+			if (x/2+y)%3 == 0 {
+				im.Set(x, y, color.White)
+			} else {
+				im.Set(x, y, color.Black)
+			}
+		}
+	}
+	// without -mode scsprites, it looks like 2 multicolor sprites.
+	assert.Equal(t, spriteExpansion{}, detectSpriteExpansion(Options{Quiet: true}, im))
+	opt := Options{Quiet: true, GraphicsMode: "scsprites", CurrentGraphicsType: singleColorSprites}
+	assert.Equal(t, spriteExpansion{x: true}, detectSpriteExpansion(opt, im))
+}
+
+func TestMirrorSprite(t *testing.T) {
+	t.Parallel()
+	sc := make([]byte, 64)
+	sc[0], sc[2], sc[63] = 0xc0, 0x01, 0x05
+	got := mirrorSprite(sc)
+	assert.Equal(t, []byte{0x80, 0x00, 0x03}, got[:3])
+	assert.Equal(t, byte(0x05), got[63])
+	assert.Equal(t, sc, mirrorSprite(got))
+
+	// in multicolor, bitpairs are mirrored as a whole.
+	mc := make([]byte, 64)
+	mc[0], mc[2], mc[63] = 0x9c, 0x01, 0x80
+	got = mirrorSprite(mc)
+	assert.Equal(t, []byte{0x40, 0x00, 0x36}, got[:3])
+	assert.Equal(t, byte(0x80), got[63])
+	assert.Equal(t, mc, mirrorSprite(got))
+}
+
+func TestDedupSprites(t *testing.T) {
+	t.Parallel()
+	a := make([]byte, 64)
+	a[0] = 0xf0
+	b := make([]byte, 64)
+	b[1] = 0x01
+	empty := make([]byte, 64)
+	bitmap := bytes.Join([][]byte{a, b, a, mirrorSprite(a), empty}, nil)
+	colors := []byte{1, 2, 3, 4, 5}
+
+	type tc struct {
+		opt          Options
+		stored       []byte
+		storedColors []byte
+		index        []byte
+	}
+	testCases := []tc{
+		{Options{}, bitmap, colors, nil},
+		{Options{SpriteTrim: true}, bitmap[:4*64], colors[:4], []byte{0, 1, 2, 3, 0xff}},
+		{Options{SpriteDedup: true}, bytes.Join([][]byte{a, b, mirrorSprite(a), empty}, nil), []byte{1, 2, 4, 5}, []byte{0, 1, 0, 2, 3}},
+		{Options{SpriteMirror: true, SpriteTrim: true}, bytes.Join([][]byte{a, b}, nil), []byte{1, 2}, []byte{0, 1, 0, 0x80, 0xff}},
+	}
+	for _, c := range testCases {
+		stored, storedColors, index, err := dedupSprites(c.opt, bitmap, colors)
+		require.Nil(t, err, c.opt)
+		assert.Equal(t, c.stored, stored, c.opt)
+		assert.Equal(t, c.storedColors, storedColors, c.opt)
+		assert.Equal(t, c.index, index, c.opt)
+	}
+
+	_, _, _, err := dedupSprites(Options{SpriteDedup: true, Display: true}, bitmap, colors)
+	assert.NotNil(t, err)
+	_, _, _, err = dedupSprites(Options{SpriteDedup: true}, make([]byte, 257*64), nil)
+	assert.NotNil(t, err)
+}
+
+func TestSpriteSheetCells(t *testing.T) {
+	t.Parallel()
+	pts := func(xy ...int) (p []image.Point) {
+		for i := 0; i < len(xy); i += 2 {
+			p = append(p, image.Pt(xy[i], xy[i+1]))
+		}
+		return p
+	}
+	// a sheet with a 1 pixel grid: 1 pixel margin and 1 pixel spacing, 25x22 pixels per cell including the grid line.
+	type tc struct {
+		opt        Options
+		w, h       int
+		want       []image.Point
+		cols, rows int
+		objW, objH byte
+		wantErr    bool
+	}
+	testCases := []tc{
+		{Options{SpriteMargin: 1, SpriteSpacing: 1}, 51, 45, pts(1, 1, 26, 1, 1, 23, 26, 23), 2, 2, 1, 1, false},
+		{Options{SpriteMargin: 1, SpriteSpacing: 1, SpriteColumnMajor: true}, 51, 45, pts(1, 1, 1, 23, 26, 1, 26, 23), 2, 2, 1, 1, false},
+		{Options{SpriteSpacing: 1, SpriteRect: "10,5,49,43"}, 100, 60, pts(10, 5, 35, 5, 10, 27, 35, 27), 2, 2, 1, 1, false},
+		{Options{SpriteMargin: 1, SpriteSpacing: 1, SpriteObjects: "2x1"}, 101, 45, pts(1, 1, 26, 1, 51, 1, 76, 1, 1, 23, 26, 23, 51, 23, 76, 23), 4, 2, 2, 1, false},
+		{Options{SpriteMargin: 1, SpriteSpacing: 1, SpriteObjects: "2x1", SpriteColumnMajor: true}, 101, 45, pts(1, 1, 26, 1, 1, 23, 26, 23, 51, 1, 76, 1, 51, 23, 76, 23), 4, 2, 2, 1, false},
+		{Options{SpriteMargin: 1, SpriteSpacing: 1, SpriteObjects: "2x2"}, 101, 45, pts(1, 1, 26, 1, 1, 23, 26, 23, 51, 1, 76, 1, 51, 23, 76, 23), 4, 2, 2, 2, false},
+		{Options{SpriteMargin: 1, SpriteSpacing: 1, SpriteExpand: "x"}, 99, 23, pts(1, 1, 50, 1), 2, 1, 1, 1, false},
+		{Options{SpriteMargin: 1, SpriteSpacing: 1, SpriteObjects: "1x2"}, 51, 67, nil, 0, 0, 1, 2, true},
+		{Options{SpriteMargin: 1, SpriteSpacing: 1}, 24, 21, nil, 0, 0, 1, 1, true},
+		{Options{SpriteRect: "50,0,24,21"}, 51, 45, nil, 0, 0, 1, 1, true},
+		{Options{SpriteMargin: -1}, 51, 45, nil, 0, 0, 0, 0, true},
+		{Options{SpriteRect: "0,0,24"}, 51, 45, nil, 0, 0, 0, 0, true},
+		{Options{SpriteObjects: "2"}, 51, 45, nil, 0, 0, 0, 0, true},
+		{Options{SpriteObjects: "0x1"}, 51, 45, nil, 0, 0, 0, 0, true},
+	}
+	for i, c := range testCases {
+		s, err := parseSpriteSheet(c.opt)
+		if err != nil {
+			assert.True(t, c.wantErr, "case %d", i)
+			continue
+		}
+		require.NotNil(t, s, "case %d", i)
+		w, h, err := spriteObjects(c.opt)
+		require.Nil(t, err, "case %d", i)
+		assert.Equal(t, c.objW, w, "case %d", i)
+		assert.Equal(t, c.objH, h, "case %d", i)
+
+		cells, cols, rows, err := s.cells(image.NewRGBA(image.Rect(0, 0, c.w, c.h)))
+		if c.wantErr {
+			assert.NotNil(t, err, "case %d", i)
+			continue
+		}
+		require.Nil(t, err, "case %d", i)
+		assert.Equal(t, c.want, cells, "case %d", i)
+		assert.Equal(t, c.cols, cols, "case %d", i)
+		assert.Equal(t, c.rows, rows, "case %d", i)
+
+		want := map[string]int{}
+		if int(w)*int(h) > 1 {
+			want = map[string]int{"numobjects": len(cells) / (int(w) * int(h)), "objectwidth": int(w), "objectheight": int(h)}
+		}
+		got := map[string]int{}
+		for _, sym := range spriteTableSymbols(c.opt, make([]byte, len(cells)*64), nil, nil, w, h) {
+			got[sym.key] = sym.value
+		}
+		assert.Equal(t, want, got, "case %d", i)
+	}
+	s, err := parseSpriteSheet(Options{})
+	assert.Nil(t, err)
+	assert.Nil(t, s)
+}
+
+func TestSpriteSheetLayout(t *testing.T) {
+	t.Parallel()
+	// mark the top left pixel of each cell in a 2x2 sheet with a 1 pixel grid, in column major order.
+	im := image.NewRGBA(image.Rect(0, 0, 51, 45))
+	marks := []color.RGBA{{1, 0, 0, 0xff}, {2, 0, 0, 0xff}, {3, 0, 0, 0xff}, {4, 0, 0, 0xff}}
+	for i, p := range []image.Point{{1, 1}, {1, 23}, {26, 1}, {26, 23}} {
+		im.Set(p.X, p.Y, marks[i])
+	}
+	s, err := parseSpriteSheet(Options{SpriteMargin: 1, SpriteSpacing: 1, SpriteColumnMajor: true})
+	require.Nil(t, err)
+	out, err := s.layout(im)
+	require.Nil(t, err)
+	assert.Equal(t, image.Rect(0, 0, 2*SpriteWidth, 2*SpriteHeight), out.Bounds())
+	// the output is tightly packed, left to right and top to bottom.
+	for i, p := range []image.Point{{0, 0}, {SpriteWidth, 0}, {0, SpriteHeight}, {SpriteWidth, SpriteHeight}} {
+		assert.Equal(t, marks[i], color.RGBAModel.Convert(out.At(p.X, p.Y)), i)
+	}
+}